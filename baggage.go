@@ -0,0 +1,269 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/posthog/posthog-go"
+)
+
+// Defaults of BaggageConfig, the limits of the W3C baggage specification.
+const (
+	DefaultBaggageMaxBytes   = 8192
+	DefaultBaggageMaxMembers = 64
+)
+
+// BaggageHeader is the name of the W3C baggage header.
+const BaggageHeader = "baggage"
+
+// Prefixes of the baggage members carrying the evaluation context.
+const (
+	baggageDistinctIDKey        = "posthog.distinct_id"
+	baggageGroupPrefix          = "posthog.group."
+	baggagePersonPropertyPrefix = "posthog.person."
+	baggageGroupPropertyPrefix  = "posthog.group_property."
+)
+
+var errBaggageTooLarge = errors.New("distinct ID exceeds the baggage limits")
+
+// BaggageConfig configures the propagation of evaluation contexts via W3C baggage.
+type BaggageConfig struct {
+	// PersonProperties are the names of the person properties propagated, all others are dropped.
+	PersonProperties []string
+	// GroupProperties are the names of the group properties propagated for every group type, all others are dropped.
+	GroupProperties []string
+	// MaxBytes is the maximum size of the baggage header. Defaults to DefaultBaggageMaxBytes.
+	MaxBytes int
+	// MaxMembers is the maximum number of members of the baggage header. Defaults to DefaultBaggageMaxMembers.
+	MaxMembers int
+}
+
+func (c BaggageConfig) withDefaults() BaggageConfig {
+	if c.MaxBytes <= 0 {
+		c.MaxBytes = DefaultBaggageMaxBytes
+	}
+	if c.MaxMembers <= 0 {
+		c.MaxMembers = DefaultBaggageMaxMembers
+	}
+	return c
+}
+
+// InjectBaggage adds the distinct ID, groups and allowed properties of the evaluation context to the baggage header,
+// so downstream services evaluate flags with the same identity. Members of other vendors already present are kept,
+// PostHog members are replaced. If the limits are exceeded, properties are dropped first, then groups. It fails if
+// not even the distinct ID fits. Evaluation contexts without a targeting key are not propagated.
+func InjectBaggage(header http.Header, evalCtx openfeature.EvaluationContext, config BaggageConfig) error {
+	config = config.withDefaults()
+
+	var members []string
+	for _, member := range parseBaggage(header.Values(BaggageHeader)) {
+		if !strings.HasPrefix(member.key, "posthog.") {
+			members = append(members, member.raw)
+		}
+	}
+	if evalCtx.TargetingKey() == "" {
+		setBaggage(header, members)
+		return nil
+	}
+
+	size := len(strings.Join(members, ","))
+	add := func(key string, value string) bool {
+		if !isBaggageToken(key) {
+			return true
+		}
+		member := key + "=" + url.PathEscape(value)
+		grown := size + len(member)
+		if len(members) > 0 {
+			grown++
+		}
+		if grown > config.MaxBytes || len(members) >= config.MaxMembers {
+			return false
+		}
+		members = append(members, member)
+		size = grown
+		return true
+	}
+
+	if !add(baggageDistinctIDKey, evalCtx.TargetingKey()) {
+		return errBaggageTooLarge
+	}
+
+	groups, _ := evalCtx.Attribute(GroupsContextKey).(posthog.Groups)
+	properties, _ := evalCtx.Attribute(PropertiesContextKey).(PostHogProperties)
+	for _, groupType := range sortedKeys(groups) {
+		if key, ok := groups[groupType].(string); ok {
+			add(baggageGroupPrefix+groupType, key)
+		}
+	}
+	for _, name := range config.PersonProperties {
+		if value, ok := properties.PersonProperties[name]; ok {
+			addProperty(add, baggagePersonPropertyPrefix+name, value)
+		}
+	}
+	for _, groupType := range sortedKeys(properties.GroupProperties) {
+		for _, name := range config.GroupProperties {
+			if value, ok := properties.GroupProperties[groupType][name]; ok {
+				addProperty(add, baggageGroupPropertyPrefix+groupType+"."+name, value)
+			}
+		}
+	}
+
+	setBaggage(header, members)
+	return nil
+}
+
+// addProperty adds the JSON encoded property value, preserving its type.
+func addProperty(add func(key, value string) bool, key string, value interface{}) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	add(key, string(b))
+}
+
+// ExtractBaggage reconstructs the evaluation context propagated by InjectBaggage from the baggage header. Only the
+// allowed properties are taken over. It reports false if the header does not carry a distinct ID or exceeds the
+// limits.
+func ExtractBaggage(header http.Header, config BaggageConfig) (openfeature.EvaluationContext, bool) {
+	config = config.withDefaults()
+
+	values := header.Values(BaggageHeader)
+	if len(strings.Join(values, ",")) > config.MaxBytes {
+		return openfeature.EvaluationContext{}, false
+	}
+	members := parseBaggage(values)
+	if len(members) > config.MaxMembers {
+		return openfeature.EvaluationContext{}, false
+	}
+
+	personProperties := allowlist(config.PersonProperties)
+	groupProperties := allowlist(config.GroupProperties)
+
+	var builder *ContextBuilder
+	var rest []baggageMember
+	for _, member := range members {
+		if member.key == baggageDistinctIDKey && member.value != "" {
+			builder = NewContext(member.value)
+		} else {
+			rest = append(rest, member)
+		}
+	}
+	if builder == nil {
+		return openfeature.EvaluationContext{}, false
+	}
+
+	for _, member := range rest {
+		switch {
+		case strings.HasPrefix(member.key, baggageGroupPrefix):
+			builder.WithGroup(strings.TrimPrefix(member.key, baggageGroupPrefix), member.value)
+		case strings.HasPrefix(member.key, baggagePersonPropertyPrefix):
+			name := strings.TrimPrefix(member.key, baggagePersonPropertyPrefix)
+			if value, ok := decodeProperty(member.value); ok && personProperties[name] {
+				builder.WithPersonProperty(name, value)
+			}
+		case strings.HasPrefix(member.key, baggageGroupPropertyPrefix):
+			groupType, name, ok := strings.Cut(strings.TrimPrefix(member.key, baggageGroupPropertyPrefix), ".")
+			if !ok || !groupProperties[name] {
+				continue
+			}
+			if value, ok := decodeProperty(member.value); ok {
+				builder.WithGroupProperty(groupType, name, value)
+			}
+		}
+	}
+	return builder.Build(), true
+}
+
+func decodeProperty(value string) (interface{}, bool) {
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		return nil, false
+	}
+	return decoded, true
+}
+
+type baggageMember struct {
+	raw   string
+	key   string
+	value string
+}
+
+// parseBaggage parses the list members of the baggage headers. Malformed members are dropped.
+func parseBaggage(values []string) []baggageMember {
+	var members []baggageMember
+	for _, value := range values {
+		for _, raw := range strings.Split(value, ",") {
+			raw = strings.TrimSpace(raw)
+			// Properties of members are not used, but kept for members of other vendors.
+			pair, _, _ := strings.Cut(raw, ";")
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				continue
+			}
+			key = strings.TrimSpace(key)
+			decoded, err := url.PathUnescape(strings.TrimSpace(value))
+			if err != nil || !isBaggageToken(key) {
+				continue
+			}
+			members = append(members, baggageMember{raw: raw, key: key, value: decoded})
+		}
+	}
+	return members
+}
+
+func setBaggage(header http.Header, members []string) {
+	if len(members) == 0 {
+		header.Del(BaggageHeader)
+		return
+	}
+	header.Set(BaggageHeader, strings.Join(members, ","))
+}
+
+// isBaggageToken reports whether the key is a valid token as defined by RFC 7230.
+func isBaggageToken(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if r > 0x7e || r <= 0x20 || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func allowlist(names []string) map[string]bool {
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		allowed[name] = true
+	}
+	return allowed
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
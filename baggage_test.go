@@ -0,0 +1,126 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/posthog/posthog-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaggage_RoundTrip(t *testing.T) {
+	config := BaggageConfig{
+		PersonProperties: []string{"plan", "seats"},
+		GroupProperties:  []string{"size"},
+	}
+	evalCtx := NewContext("user 12345, \"quoted\"").
+		WithGroup("company", "acme").
+		WithPersonProperty("plan", "pro").
+		WithPersonProperty("seats", 10).
+		WithPersonProperty("email", "jane@example.com").
+		WithGroupProperty("company", "size", 50).
+		WithGroupProperty("company", "name", "Acme").
+		Build()
+
+	header := http.Header{}
+	header.Set(BaggageHeader, "vendor=value;property, posthog.distinct_id=stale")
+	require.NoError(t, InjectBaggage(header, evalCtx, config))
+	assert.True(t, strings.HasPrefix(header.Get(BaggageHeader), "vendor=value;property,"))
+	assert.NotContains(t, header.Get(BaggageHeader), "stale")
+	assert.NotContains(t, header.Get(BaggageHeader), "email")
+
+	extracted, ok := ExtractBaggage(header, config)
+	require.True(t, ok)
+	expected := NewContext("user 12345, \"quoted\"").
+		WithGroup("company", "acme").
+		WithPersonProperty("plan", "pro").
+		WithPersonProperty("seats", float64(10)).
+		WithGroupProperty("company", "size", float64(50)).
+		Build()
+	assert.Equal(t, expected, extracted)
+}
+
+func TestExtractBaggage(t *testing.T) {
+	config := BaggageConfig{PersonProperties: []string{"plan"}, MaxBytes: 100, MaxMembers: 3}
+
+	tcs := map[string]struct {
+		baggage  string
+		expected openfeature.EvaluationContext
+		ok       bool
+	}{
+		"distinct ID": {
+			baggage:  "posthog.distinct_id=12345",
+			expected: NewContext("12345").Build(),
+			ok:       true,
+		},
+		"disallowed property": {
+			baggage:  "posthog.distinct_id=12345,posthog.person.role=%22admin%22,posthog.person.plan=%22pro%22",
+			expected: NewContext("12345").WithPersonProperty("plan", "pro").Build(),
+			ok:       true,
+		},
+		"malformed members": {
+			baggage:  "posthog.distinct_id=12345,invalid,posthog.person.plan=not-json",
+			expected: NewContext("12345").Build(),
+			ok:       true,
+		},
+		"missing distinct ID": {
+			baggage: "vendor=value,posthog.group.company=acme",
+		},
+		"too many members": {
+			baggage: "posthog.distinct_id=12345,a=1,b=2,c=3",
+		},
+		"too large": {
+			baggage: "posthog.distinct_id=" + strings.Repeat("x", 100),
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(BaggageHeader, tc.baggage)
+
+			evalCtx, ok := ExtractBaggage(header, config)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.expected, evalCtx)
+		})
+	}
+}
+
+func TestInjectBaggage_Limits(t *testing.T) {
+	evalCtx := NewContext("12345").
+		WithGroup("company", "acme").
+		WithPersonProperty("plan", "pro").
+		Build()
+
+	header := http.Header{}
+	require.NoError(t, InjectBaggage(header, evalCtx, BaggageConfig{PersonProperties: []string{"plan"}, MaxMembers: 2}))
+	assert.Equal(t, "posthog.distinct_id=12345,posthog.group.company=acme", header.Get(BaggageHeader))
+
+	header = http.Header{}
+	err := InjectBaggage(header, evalCtx, BaggageConfig{MaxBytes: 10})
+	assert.ErrorIs(t, err, errBaggageTooLarge)
+
+	// Contexts without a distinct ID are not propagated.
+	header = http.Header{}
+	require.NoError(t, InjectBaggage(header, openfeature.NewTargetlessEvaluationContext(map[string]interface{}{
+		GroupsContextKey: posthog.Groups{"company": "acme"},
+	}), BaggageConfig{}))
+	assert.Empty(t, header.Get(BaggageHeader))
+}
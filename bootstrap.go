@@ -0,0 +1,103 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Bootstrap are flag values baked into the provider, mirroring the bootstrap feature of posthog-js.
+//
+// Values may be booleans, strings, numbers or JSON-encodable objects. They are evaluated the same way as values
+// returned by PostHog, e.g. the string "20" or the number 20 both evaluate to the integer 20.
+type Bootstrap struct {
+	// Flags are the values per flag key, used for every distinct ID.
+	Flags map[string]interface{}
+	// DistinctIDs are the values per distinct ID and flag key. They take precedence over Flags.
+	DistinctIDs map[string]map[string]interface{}
+}
+
+// WithBootstrap seeds the provider with the bootstrap values. They are served with the STATIC reason whenever PostHog
+// cannot evaluate a flag, e.g. because it cannot be reached, does not respond in time or the circuit breaker is open.
+// Last known values of a configured fallback store take precedence over bootstrap values.
+func WithBootstrap(bootstrap Bootstrap) Option {
+	normalized := Bootstrap{
+		Flags:       normalizeBootstrapValues(bootstrap.Flags),
+		DistinctIDs: make(map[string]map[string]interface{}, len(bootstrap.DistinctIDs)),
+	}
+	for distinctID, values := range bootstrap.DistinctIDs {
+		normalized.DistinctIDs[distinctID] = normalizeBootstrapValues(values)
+	}
+
+	return func(p *Provider) {
+		p.bootstrap = &normalized
+	}
+}
+
+// lookup returns the bootstrap value of the flag for the distinct ID.
+func (b *Bootstrap) lookup(flag, distinctID string) (interface{}, bool) {
+	if value, ok := b.DistinctIDs[distinctID][flag]; ok {
+		return value, true
+	}
+	value, ok := b.Flags[flag]
+	return value, ok
+}
+
+// all returns the bootstrap values of all flags for the distinct ID.
+func (b *Bootstrap) all(distinctID string) map[string]interface{} {
+	values := make(map[string]interface{}, len(b.Flags))
+	for flag, value := range b.Flags {
+		values[flag] = value
+	}
+	for flag, value := range b.DistinctIDs[distinctID] {
+		values[flag] = value
+	}
+	return values
+}
+
+func normalizeBootstrapValues(values map[string]interface{}) map[string]interface{} {
+	normalized := make(map[string]interface{}, len(values))
+	for flag, value := range values {
+		normalized[flag] = toPostHogValue(value)
+	}
+	return normalized
+}
+
+// toPostHogValue converts the value to the representation returned by PostHog, which is either a boolean or
+// a string.
+func toPostHogValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bool, string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(b)
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvider_Bootstrap(t *testing.T) {
+	client := posthogtest.NewFaultyClient(posthogtest.NewClient(
+		posthogtest.Flag{Key: "string-flag", Value: "posthog"},
+	), posthogtest.Faults{ErrorRate: 1})
+	p := NewProvider(client, WithBootstrap(Bootstrap{
+		Flags: map[string]interface{}{
+			"bool-flag":   true,
+			"string-flag": "bootstrap",
+			"int-flag":    20,
+			"float-flag":  "1.5",
+			"object-flag": map[string]interface{}{"enabled": true},
+		},
+		DistinctIDs: map[string]map[string]interface{}{
+			"67890": {"string-flag": "beta"},
+		},
+	}))
+	evalCtx := openfeature.FlattenedContext{DistinctIDContextKey: "12345"}
+
+	b := p.BooleanEvaluation(context.Background(), "bool-flag", false, evalCtx)
+	assert.True(t, b.Value)
+	assert.Equal(t, openfeature.StaticReason, b.Reason)
+
+	s := p.StringEvaluation(context.Background(), "string-flag", "default", evalCtx)
+	assert.Equal(t, "bootstrap", s.Value)
+	assert.Equal(t, openfeature.StaticReason, s.Reason)
+
+	s = p.StringEvaluation(context.Background(), "string-flag", "default", openfeature.FlattenedContext{
+		DistinctIDContextKey: "67890",
+	})
+	assert.Equal(t, "beta", s.Value)
+
+	i := p.IntEvaluation(context.Background(), "int-flag", 10, evalCtx)
+	assert.Equal(t, int64(20), i.Value)
+
+	f := p.FloatEvaluation(context.Background(), "float-flag", 1, evalCtx)
+	assert.Equal(t, 1.5, f.Value)
+
+	o := p.ObjectEvaluation(context.Background(), "object-flag", nil, evalCtx)
+	assert.Equal(t, map[string]interface{}{"enabled": true}, o.Value)
+
+	// Flags without a bootstrap value resolve to the default value.
+	s = p.StringEvaluation(context.Background(), "unknown-flag", "default", evalCtx)
+	assert.Equal(t, "default", s.Value)
+	assert.Equal(t, openfeature.ErrorReason, s.Reason)
+
+	// Once PostHog is reachable, its values are served.
+	client.SetFaults(posthogtest.Faults{})
+	s = p.StringEvaluation(context.Background(), "string-flag", "default", evalCtx)
+	assert.Equal(t, "posthog", s.Value)
+	assert.Equal(t, openfeature.TargetingMatchReason, s.Reason)
+}
+
+func TestProvider_BootstrapAfterFallbackStore(t *testing.T) {
+	client := posthogtest.NewFaultyClient(posthogtest.NewClient(
+		posthogtest.Flag{Key: "string-flag", Value: "posthog"},
+	), posthogtest.Faults{})
+	p := NewProvider(client,
+		WithFallbackStore(NewMemoryFallbackStore(FallbackStoreConfig{})),
+		WithBootstrap(Bootstrap{Flags: map[string]interface{}{"string-flag": "bootstrap"}}),
+	)
+	evalCtx := openfeature.FlattenedContext{DistinctIDContextKey: "12345"}
+
+	p.StringEvaluation(context.Background(), "string-flag", "default", evalCtx)
+	client.SetFaults(posthogtest.Faults{ErrorRate: 1})
+
+	s := p.StringEvaluation(context.Background(), "string-flag", "default", evalCtx)
+	assert.Equal(t, "posthog", s.Value)
+	assert.Equal(t, StaleReason, s.Reason)
+
+	s = p.StringEvaluation(context.Background(), "string-flag", "default", openfeature.FlattenedContext{
+		DistinctIDContextKey: "67890",
+	})
+	assert.Equal(t, "bootstrap", s.Value)
+	assert.Equal(t, openfeature.StaticReason, s.Reason)
+}
@@ -0,0 +1,302 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/posthog/posthog-go"
+)
+
+// ResolvedFlag is a flag evaluated by EvaluateAll.
+type ResolvedFlag struct {
+	// Value is true or false for boolean flags and the key of the variant for multivariate flags.
+	Value interface{}
+	// Variant is the key of the variant for multivariate flags.
+	Variant string
+	// Reason is the reason of the evaluation.
+	Reason openfeature.Reason
+	// Payload is the JSON payload of the flag for the value, if any.
+	Payload string
+	// PayloadErr is the error of resolving the payload, if any. The value of the flag is valid regardless.
+	PayloadErr error
+	// FlagMetadata is the metadata of the evaluation, e.g. the source of overrides.
+	FlagMetadata openfeature.FlagMetadata
+}
+
+// EvaluateAll evaluates all flags for the evaluation context with a single call to PostHog, e.g. to render them
+// server-side or to bootstrap frontends. The evaluation context is merged over the transaction context of ctx. Overrides,
+// caching and fallbacks apply the same way as for single evaluations, values served from the fallback store or the
+// bootstrap values are reported with their reason.
+//
+// The payloads of enabled flags are resolved from the flag definitions, which are available to clients configured with
+// a personal API key. Other clients, as well as clients which failed to load the definitions, call PostHog once per
+// enabled flag with a value evaluated by PostHog. Failing to resolve a payload is reported by ResolvedFlag.PayloadErr.
+func (p *Provider) EvaluateAll(ctx context.Context, evalCtx openfeature.EvaluationContext) (map[string]ResolvedFlag, error) {
+	payload, err := translateFeatureFlagPayload(flattenContext(withTransactionContext(ctx, evalCtx)), "")
+	if err != nil {
+		return nil, err
+	}
+
+	flags, err := p.allFlags(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	payloads := payloadResolver{provider: p}
+	resolved := make(map[string]ResolvedFlag, len(flags))
+	for key, res := range flags {
+		flag := ResolvedFlag{
+			Value:        res.value,
+			Reason:       res.reason,
+			FlagMetadata: res.metadata,
+		}
+		if variant, ok := res.value.(string); ok {
+			flag.Variant = variant
+		}
+		// Overridden values and values served while PostHog fails have no payload.
+		if res.found && (res.reason == openfeature.TargetingMatchReason || res.reason == openfeature.CachedReason) {
+			payload.Key = key
+			flag.Payload, flag.PayloadErr = payloads.resolve(ctx, payload, res.value)
+		}
+		resolved[key] = flag
+	}
+	return resolved, nil
+}
+
+// allFlagsKey is the key under which the values of all flags are cached and kept in the fallback store. It is not a
+// valid PostHog flag key.
+const allFlagsKey = "$all_flags"
+
+// allFlags evaluates all flags, from the definitions snapshot until the live definitions are loaded and by PostHog
+// otherwise. Overrides take precedence over the evaluated values.
+func (p *Provider) allFlags(ctx context.Context, payload posthog.FeatureFlagPayload) (map[string]flagResult, error) {
+	values, reason, err := p.evaluateAllFlags(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := make(map[string]flagResult, len(values))
+	for key, value := range values {
+		if res, ok := p.override(ctx, key); ok {
+			flags[key] = res
+			continue
+		}
+
+		enabled, isBool := value.(bool)
+		flags[key] = flagResult{value: value, found: !isBool || enabled, reason: reason}
+	}
+	return flags, nil
+}
+
+// evaluateAllFlags evaluates all flags the same way getFeatureFlag evaluates a single flag: from the snapshot, the
+// cache or PostHog, falling back to the last known values or the bootstrap values if PostHog fails.
+func (p *Provider) evaluateAllFlags(ctx context.Context, payload posthog.FeatureFlagPayload) (map[string]interface{}, openfeature.Reason, error) {
+	if p.snapshot != nil {
+		if values, ok := p.snapshot.evaluateAll(payload); ok {
+			return values, openfeature.CachedReason, nil
+		}
+	}
+
+	payload.Key = allFlagsKey
+	reason := openfeature.TargetingMatchReason
+	var res interface{}
+	var err error
+	if p.cache != nil {
+		var cached bool
+		res, cached, err = p.cache.get(ctx, payload, p.fetchAllFlags)
+		if cached {
+			reason = openfeature.CachedReason
+		}
+	} else {
+		res, err = p.fetchAllFlags(ctx, payload)
+	}
+
+	if err != nil {
+		var ok bool
+		res, reason, ok = p.lastResortAll(payload.DistinctId)
+		if !ok {
+			return nil, "", err
+		}
+	}
+	values, _ := res.(map[string]interface{})
+	return values, reason, nil
+}
+
+// lastResortAll returns the values served when PostHog failed to evaluate all flags: the last known values of the
+// fallback store or the bootstrap values, if configured.
+func (p *Provider) lastResortAll(distinctID string) (interface{}, openfeature.Reason, bool) {
+	if p.fallback != nil {
+		if stale, ok := p.fallback.Load(allFlagsKey, distinctID); ok {
+			return stale, StaleReason, true
+		}
+	}
+	if p.bootstrap != nil {
+		if values := p.bootstrap.all(distinctID); len(values) > 0 {
+			return values, openfeature.StaticReason, true
+		}
+	}
+	return nil, "", false
+}
+
+// fetchAllFlags evaluates all flags with PostHog and keeps successful results in the fallback store, if configured.
+func (p *Provider) fetchAllFlags(ctx context.Context, payload posthog.FeatureFlagPayload) (interface{}, error) {
+	res, err := p.callClient(ctx, func() (interface{}, error) {
+		return p.client.GetAllFlags(posthog.FeatureFlagPayloadNoKey{
+			DistinctId:       payload.DistinctId,
+			Groups:           payload.Groups,
+			PersonProperties: payload.PersonProperties,
+			GroupProperties:  payload.GroupProperties,
+		})
+	})
+	if err == nil && p.fallback != nil {
+		p.fallback.Store(allFlagsKey, payload.DistinctId, res)
+	}
+	return res, err
+}
+
+// payloadResolver resolves the payloads of the flags evaluated by EvaluateAll.
+type payloadResolver struct {
+	provider *Provider
+	// definitions are the flag definitions of the client by key, loaded on first use. They are nil if the client does
+	// not evaluate flags locally.
+	definitions map[string]posthog.FeatureFlag
+	loaded      bool
+}
+
+// resolve returns the payload of the flag for the evaluated value, from the definitions snapshot until the live
+// definitions are loaded, from the flag definitions of the client if available and by PostHog otherwise.
+func (r *payloadResolver) resolve(ctx context.Context, payload posthog.FeatureFlagPayload, value interface{}) (string, error) {
+	p := r.provider
+	if p.snapshot != nil {
+		if res, ok := p.snapshot.payload(payload.Key, value); ok {
+			return res, nil
+		}
+	}
+	if !r.loaded {
+		r.definitions, r.loaded = p.flagDefinitions(), true
+	}
+	if flag, ok := r.definitions[payload.Key]; ok {
+		return flag.Filters.Payloads[fmt.Sprint(value)], nil
+	}
+
+	res, err := p.callClient(ctx, func() (interface{}, error) {
+		return p.client.GetFeatureFlagPayload(payload)
+	})
+	if err != nil {
+		return "", err
+	}
+	s, _ := res.(string)
+	return s, nil
+}
+
+// flagDefinitions returns the flag definitions of the client by key, or nil if the client does not return them.
+func (p *Provider) flagDefinitions() map[string]posthog.FeatureFlag {
+	if !p.definitions.allow() {
+		return nil
+	}
+	flags, err := p.client.GetFeatureFlags()
+	p.definitions.record(err)
+	if err != nil {
+		return nil
+	}
+
+	definitions := make(map[string]posthog.FeatureFlag, len(flags))
+	for _, flag := range flags {
+		definitions[flag.Key] = flag
+	}
+	return definitions
+}
+
+// Backoff of requesting the flag definitions after transient failures, e.g. while they are not loaded yet.
+const (
+	definitionsInitialBackoff = time.Second
+	definitionsMaxBackoff     = time.Minute
+)
+
+// definitionsBackoff tracks the failures of the client to return the flag definitions, as the client logs every
+// failure. Clients without a personal API key never return them, other failures are retried with exponential backoff.
+type definitionsBackoff struct {
+	// now defaults to time.Now.
+	now func() time.Time
+
+	mu          sync.Mutex
+	unsupported bool
+	backoff     time.Duration
+	retryAt     time.Time
+}
+
+// allow reports whether the flag definitions should be requested.
+func (b *definitionsBackoff) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.unsupported && !b.timeNow().Before(b.retryAt)
+}
+
+// record records the result of requesting the flag definitions.
+func (b *definitionsBackoff) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case err == nil:
+		b.backoff = 0
+		b.retryAt = time.Time{}
+	case isNoPersonalAPIKey(err):
+		b.unsupported = true
+	default:
+		b.backoff = min(max(2*b.backoff, definitionsInitialBackoff), definitionsMaxBackoff)
+		b.retryAt = b.timeNow().Add(b.backoff)
+	}
+}
+
+func (b *definitionsBackoff) timeNow() time.Time {
+	if b.now == nil {
+		return time.Now()
+	}
+	return b.now()
+}
+
+// withTransactionContext merges the evaluation context over the transaction context of ctx, the same way the OpenFeature
+// SDK merges them for single evaluations.
+func withTransactionContext(ctx context.Context, evalCtx openfeature.EvaluationContext) openfeature.EvaluationContext {
+	transaction := openfeature.TransactionContext(ctx)
+	attributes := transaction.Attributes()
+	for key, value := range evalCtx.Attributes() {
+		attributes[key] = value
+	}
+
+	targetingKey := evalCtx.TargetingKey()
+	if targetingKey == "" {
+		targetingKey = transaction.TargetingKey()
+	}
+	return openfeature.NewEvaluationContext(targetingKey, attributes)
+}
+
+// flattenContext flattens the evaluation context the same way the OpenFeature SDK does before calling the provider.
+func flattenContext(evalCtx openfeature.EvaluationContext) openfeature.FlattenedContext {
+	flat := openfeature.FlattenedContext{}
+	for key, value := range evalCtx.Attributes() {
+		flat[key] = value
+	}
+	if evalCtx.TargetingKey() != "" {
+		flat[DistinctIDContextKey] = evalCtx.TargetingKey()
+	}
+	return flat
+}
@@ -0,0 +1,256 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/posthog/posthog-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_EvaluateAll(t *testing.T) {
+	client := posthogtest.NewClient(
+		posthogtest.Flag{Key: "bool-flag", Value: true, Payload: `{"enabled": true}`},
+		posthogtest.Flag{
+			Key:     "variant-flag",
+			Value:   "control",
+			Payload: `{"color": "blue"}`,
+			Rules: []posthogtest.Rule{
+				{Groups: posthog.Groups{"company": "acme"}, Value: "acme", Payload: `{"color": "red"}`},
+			},
+		},
+		posthogtest.Flag{Key: "disabled-flag"},
+		posthogtest.Flag{Key: "overridden-flag", Value: "control"},
+	)
+	p := NewProvider(client)
+	ctx := ContextWithOverrides(context.Background(), map[string]interface{}{"overridden-flag": "test"})
+
+	flags, err := p.EvaluateAll(ctx, NewContext("12345").WithGroup("company", "acme").Build())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]ResolvedFlag{
+		"bool-flag": {
+			Value:   true,
+			Reason:  openfeature.TargetingMatchReason,
+			Payload: `{"enabled": true}`,
+		},
+		"variant-flag": {
+			Value:   "acme",
+			Variant: "acme",
+			Reason:  openfeature.TargetingMatchReason,
+			Payload: `{"color": "red"}`,
+		},
+		"disabled-flag": {
+			Value:  false,
+			Reason: openfeature.TargetingMatchReason,
+		},
+		"overridden-flag": {
+			Value:        "test",
+			Variant:      "test",
+			Reason:       OverrideReason,
+			FlagMetadata: openfeature.FlagMetadata{SourceMetadataKey: RequestOverrideSource},
+		},
+	}, flags)
+
+	_, err = p.EvaluateAll(ctx, openfeature.NewTargetlessEvaluationContext(nil))
+	assert.ErrorIs(t, err, errMissingTargetKey)
+
+	p = NewProvider(unreachableClient{Client: client})
+	_, err = p.EvaluateAll(ctx, NewContext("12345").Build())
+	assert.ErrorIs(t, err, posthogtest.ErrInjected)
+}
+
+// unreachableClient fails to evaluate all flags.
+type unreachableClient struct {
+	posthog.Client
+}
+
+func (unreachableClient) GetAllFlags(posthog.FeatureFlagPayloadNoKey) (map[string]interface{}, error) {
+	return nil, posthogtest.ErrInjected
+}
+
+func TestProvider_EvaluateAllFromSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "definitions.json")
+	b, err := json.Marshal([]posthog.FeatureFlag{{
+		Key:    "variant-flag",
+		Active: true,
+		Filters: posthog.Filter{
+			Groups: []posthog.FeatureFlagCondition{{RolloutPercentage: ptr[uint8](100)}},
+			Multivariate: &posthog.Variants{Variants: []posthog.FlagVariant{
+				{Key: "snapshot", RolloutPercentage: ptr[uint8](100)},
+			}},
+			Payloads: map[string]string{"snapshot": `{"color": "green"}`},
+		},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+
+	client := &loadingClient{
+		flakyClient: &flakyClient{Client: posthogtest.NewClient(posthogtest.Flag{Key: "variant-flag", Value: "posthog"})},
+		release:     make(chan struct{}),
+	}
+	defer close(client.release)
+	p := NewProvider(client, WithDefinitionsSnapshot(path))
+	require.NoError(t, p.Init(openfeature.EvaluationContext{}))
+
+	flags, err := p.EvaluateAll(context.Background(), NewContext("12345").Build())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]ResolvedFlag{
+		"variant-flag": {
+			Value:   "snapshot",
+			Variant: "snapshot",
+			Reason:  openfeature.CachedReason,
+			Payload: `{"color": "green"}`,
+		},
+	}, flags)
+	assert.Equal(t, 0, client.calls)
+}
+
+// payloadClient counts the requests of flag definitions and payloads. Requesting the flag definitions fails with
+// definitionsErr, if set, e.g. like clients configured without a personal API key. Fetching the payload of the failing
+// flag fails.
+type payloadClient struct {
+	posthog.Client
+	definitionsErr   error
+	failing          string
+	definitionsCalls int
+	payloadCalls     int
+}
+
+func (c *payloadClient) GetFeatureFlags() ([]posthog.FeatureFlag, error) {
+	c.definitionsCalls++
+	if c.definitionsErr != nil {
+		return nil, c.definitionsErr
+	}
+	return c.Client.GetFeatureFlags()
+}
+
+func (c *payloadClient) GetFeatureFlagPayload(payload posthog.FeatureFlagPayload) (string, error) {
+	c.payloadCalls++
+	if payload.Key == c.failing {
+		return "", posthogtest.ErrInjected
+	}
+	return c.Client.GetFeatureFlagPayload(payload)
+}
+
+func TestProvider_EvaluateAllPayloads(t *testing.T) {
+	fake := posthogtest.NewClient(
+		posthogtest.Flag{Key: "bool-flag", Value: true, Payload: `{"enabled": true}`},
+		posthogtest.Flag{Key: "variant-flag", Value: "control", Payload: `{"color": "blue"}`},
+		posthogtest.Flag{Key: "disabled-flag"},
+	)
+	evalCtx := NewContext("12345").Build()
+
+	// Payloads are resolved from the flag definitions without calling PostHog.
+	client := &payloadClient{Client: fake}
+	flags, err := NewProvider(client).EvaluateAll(context.Background(), evalCtx)
+	require.NoError(t, err)
+	assert.Equal(t, `{"enabled": true}`, flags["bool-flag"].Payload)
+	assert.Equal(t, `{"color": "blue"}`, flags["variant-flag"].Payload)
+	assert.Equal(t, 0, client.payloadCalls)
+
+	// Without flag definitions, payloads are fetched per enabled flag and failures are reported per flag.
+	client = &payloadClient{Client: fake, definitionsErr: errNoPersonalAPIKey, failing: "variant-flag"}
+	p := NewProvider(client)
+	flags, err = p.EvaluateAll(context.Background(), evalCtx)
+	require.NoError(t, err)
+	assert.Equal(t, `{"enabled": true}`, flags["bool-flag"].Payload)
+	assert.NoError(t, flags["bool-flag"].PayloadErr)
+	assert.Equal(t, "control", flags["variant-flag"].Value)
+	assert.Empty(t, flags["variant-flag"].Payload)
+	assert.ErrorIs(t, flags["variant-flag"].PayloadErr, posthogtest.ErrInjected)
+	assert.Equal(t, 2, client.payloadCalls)
+
+	// The flag definitions are not requested again from clients without a personal API key.
+	_, err = p.EvaluateAll(context.Background(), evalCtx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, client.definitionsCalls)
+}
+
+func TestProvider_EvaluateAllDefinitionsBackoff(t *testing.T) {
+	fake := posthogtest.NewClient(posthogtest.Flag{Key: "variant-flag", Value: "control", Payload: `{"color": "blue"}`})
+	client := &payloadClient{Client: fake, definitionsErr: errors.New("flags were not successfully fetched yet")}
+	p := NewProvider(client)
+	now := time.Now()
+	p.definitions.now = func() time.Time { return now }
+	evaluate := func() ResolvedFlag {
+		flags, err := p.EvaluateAll(context.Background(), NewContext("12345").Build())
+		require.NoError(t, err)
+		return flags["variant-flag"]
+	}
+
+	// Transient failures fall back to fetching the payloads.
+	assert.Equal(t, `{"color": "blue"}`, evaluate().Payload)
+	assert.Equal(t, 1, client.definitionsCalls)
+	assert.Equal(t, 1, client.payloadCalls)
+
+	// The flag definitions are not requested again until the backoff elapsed.
+	client.definitionsErr = nil
+	evaluate()
+	assert.Equal(t, 1, client.definitionsCalls)
+	assert.Equal(t, 2, client.payloadCalls)
+
+	now = now.Add(definitionsInitialBackoff)
+	assert.Equal(t, `{"color": "blue"}`, evaluate().Payload)
+	assert.Equal(t, 2, client.definitionsCalls)
+	assert.Equal(t, 2, client.payloadCalls)
+}
+
+func TestProvider_EvaluateAllTransactionContext(t *testing.T) {
+	p := NewProvider(posthogtest.NewClient(posthogtest.Flag{
+		Key:   "variant-flag",
+		Value: "control",
+		Rules: []posthogtest.Rule{{DistinctIDs: []string{"12345"}, Groups: posthog.Groups{"company": "acme"}, Value: "acme"}},
+	}))
+	ctx := openfeature.WithTransactionContext(context.Background(), NewContext("12345").Build())
+
+	flags, err := p.EvaluateAll(ctx, NewContext("").WithGroup("company", "acme").Build())
+	require.NoError(t, err)
+	assert.Equal(t, "acme", flags["variant-flag"].Value)
+}
+
+func TestProvider_EvaluateAllFallbacks(t *testing.T) {
+	client := posthogtest.NewClient(posthogtest.Flag{Key: "variant-flag", Value: "control", Payload: `{"color": "blue"}`})
+	store := NewMemoryFallbackStore(FallbackStoreConfig{})
+	evalCtx := NewContext("12345").Build()
+
+	flags, err := NewProvider(client, WithFallbackStore(store)).EvaluateAll(context.Background(), evalCtx)
+	require.NoError(t, err)
+	assert.Equal(t, openfeature.TargetingMatchReason, flags["variant-flag"].Reason)
+
+	// The last known values are served without payloads while PostHog is unreachable.
+	p := NewProvider(unreachableClient{Client: client}, WithFallbackStore(store))
+	flags, err = p.EvaluateAll(context.Background(), evalCtx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]ResolvedFlag{
+		"variant-flag": {Value: "control", Variant: "control", Reason: StaleReason},
+	}, flags)
+
+	p = NewProvider(unreachableClient{Client: client}, WithBootstrap(Bootstrap{Flags: map[string]interface{}{"variant-flag": "test"}}))
+	flags, err = p.EvaluateAll(context.Background(), evalCtx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]ResolvedFlag{
+		"variant-flag": {Value: "test", Variant: "test", Reason: openfeature.StaticReason},
+	}, flags)
+}
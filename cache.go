@@ -0,0 +1,180 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/posthog/posthog-go"
+)
+
+// DefaultCacheMaxEntries is the default of CacheConfig.MaxEntries.
+const DefaultCacheMaxEntries = 10000
+
+// CacheConfig configures the caching of evaluation results.
+type CacheConfig struct {
+	// SoftTTL is the duration a result is considered fresh and served from the cache without calling PostHog.
+	SoftTTL time.Duration
+	// HardTTL is the maximum age of a result served from the cache. Results older than SoftTTL but younger than HardTTL
+	// are served immediately while being refreshed in the background. If HardTTL is not greater than SoftTTL, results
+	// expire after SoftTTL and are refreshed synchronously.
+	HardTTL time.Duration
+	// MaxEntries is the maximum number of cached results. Defaults to DefaultCacheMaxEntries.
+	MaxEntries int
+}
+
+// WithCache caches the evaluation results per flag and evaluation context. Results served from the cache are reported
+// with the CACHED reason. Failed evaluations are not cached.
+func WithCache(config CacheConfig) Option {
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = DefaultCacheMaxEntries
+	}
+	if config.HardTTL < config.SoftTTL {
+		config.HardTTL = config.SoftTTL
+	}
+
+	return func(p *Provider) {
+		p.cache = &resultCache{
+			config:  config,
+			now:     time.Now,
+			entries: make(map[string]*list.Element),
+			order:   list.New(),
+		}
+	}
+}
+
+type cacheEntry struct {
+	key        string
+	value      interface{}
+	fetchedAt  time.Time
+	refreshing bool
+}
+
+type resultCache struct {
+	config CacheConfig
+	now    func() time.Time
+	// refreshes tracks the background refreshes.
+	refreshes sync.WaitGroup
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order lists the entries from the most to the least recently used.
+	order *list.List
+}
+
+// get returns the cached result for the payload and whether it was served from the cache. Missing or expired results
+// are fetched synchronously, stale results are refreshed in the background.
+func (c *resultCache) get(ctx context.Context, payload posthog.FeatureFlagPayload,
+	fetch func(context.Context, posthog.FeatureFlagPayload) (interface{}, error)) (interface{}, bool, error) {
+	key, ok := cacheKey(payload)
+	if !ok {
+		res, err := fetch(ctx, payload)
+		return res, false, err
+	}
+
+	c.mu.Lock()
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		entry := element.Value.(*cacheEntry)
+		age := c.now().Sub(entry.fetchedAt)
+		if age < c.config.SoftTTL {
+			c.mu.Unlock()
+			return entry.value, true, nil
+		}
+		if age < c.config.HardTTL {
+			if !entry.refreshing {
+				entry.refreshing = true
+				c.refreshes.Add(1)
+				go c.refresh(context.WithoutCancel(ctx), key, payload, fetch)
+			}
+			c.mu.Unlock()
+			return entry.value, true, nil
+		}
+	}
+	c.mu.Unlock()
+
+	res, err := fetch(ctx, payload)
+	if err == nil {
+		c.set(key, res)
+	}
+	return res, false, err
+}
+
+func (c *resultCache) refresh(ctx context.Context, key string, payload posthog.FeatureFlagPayload,
+	fetch func(context.Context, posthog.FeatureFlagPayload) (interface{}, error)) {
+	defer c.refreshes.Done()
+
+	res, err := fetch(ctx, payload)
+	if err == nil {
+		c.set(key, res)
+		return
+	}
+
+	// Keep serving the stale result until it expires, the next request after SoftTTL retries the refresh.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*cacheEntry).refreshing = false
+	}
+}
+
+func (c *resultCache) set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{key: key, value: value, fetchedAt: c.now()}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.config.MaxEntries {
+		c.evictOldest()
+	}
+}
+
+// evictOldest removes the least recently used entry. The caller must hold the lock.
+func (c *resultCache) evictOldest() {
+	oldest := c.order.Back()
+	c.order.Remove(oldest)
+	delete(c.entries, oldest.Value.(*cacheEntry).key)
+}
+
+// cacheKey returns the key of the payload. Payloads with properties which cannot be encoded are not cached.
+func cacheKey(payload posthog.FeatureFlagPayload) (string, bool) {
+	b, err := json.Marshal(struct {
+		Key              string
+		DistinctID       string
+		Groups           posthog.Groups
+		PersonProperties posthog.Properties
+		GroupProperties  map[string]posthog.Properties
+	}{
+		Key:              payload.Key,
+		DistinctID:       payload.DistinctId,
+		Groups:           payload.Groups,
+		PersonProperties: payload.PersonProperties,
+		GroupProperties:  payload.GroupProperties,
+	})
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/posthog/posthog-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvider_CacheStaleWhileRevalidate(t *testing.T) {
+	fake := posthogtest.NewClient(posthogtest.Flag{Key: "string-flag", Value: "v1"})
+	client := &flakyClient{Client: fake}
+	p := NewProvider(client, WithCache(CacheConfig{SoftTTL: time.Minute, HardTTL: time.Hour}))
+
+	now := time.Now()
+	p.cache.now = func() time.Time { return now }
+	evalCtx := openfeature.FlattenedContext{DistinctIDContextKey: "12345"}
+	evaluate := func() openfeature.StringResolutionDetail {
+		return p.StringEvaluation(context.Background(), "string-flag", "default", evalCtx)
+	}
+
+	res := evaluate()
+	assert.Equal(t, "v1", res.Value)
+	assert.Equal(t, openfeature.TargetingMatchReason, res.Reason)
+
+	// Fresh results are served from the cache.
+	fake.SetFlag(posthogtest.Flag{Key: "string-flag", Value: "v2"})
+	res = evaluate()
+	assert.Equal(t, "v1", res.Value)
+	assert.Equal(t, openfeature.CachedReason, res.Reason)
+	assert.Equal(t, 1, client.calls)
+
+	// Stale results are served immediately and refreshed in the background.
+	now = now.Add(2 * time.Minute)
+	res = evaluate()
+	assert.Equal(t, "v1", res.Value)
+	assert.Equal(t, openfeature.CachedReason, res.Reason)
+	p.cache.refreshes.Wait()
+	assert.Equal(t, 2, client.calls)
+
+	res = evaluate()
+	assert.Equal(t, "v2", res.Value)
+	assert.Equal(t, openfeature.CachedReason, res.Reason)
+
+	// Expired results are fetched synchronously.
+	fake.SetFlag(posthogtest.Flag{Key: "string-flag", Value: "v3"})
+	now = now.Add(2 * time.Hour)
+	res = evaluate()
+	assert.Equal(t, "v3", res.Value)
+	assert.Equal(t, openfeature.TargetingMatchReason, res.Reason)
+	assert.Equal(t, 3, client.calls)
+}
+
+func TestProvider_CacheKeyedByContext(t *testing.T) {
+	client := &flakyClient{Client: posthogtest.NewClient(posthogtest.Flag{
+		Key:   "string-flag",
+		Value: "control",
+		Rules: []posthogtest.Rule{{Groups: posthog.Groups{"company": "acme"}, Value: "acme"}},
+	})}
+	p := NewProvider(client, WithCache(CacheConfig{SoftTTL: time.Minute}))
+
+	res := p.StringEvaluation(context.Background(), "string-flag", "default", openfeature.FlattenedContext{
+		DistinctIDContextKey: "12345",
+	})
+	assert.Equal(t, "control", res.Value)
+
+	res = p.StringEvaluation(context.Background(), "string-flag", "default", openfeature.FlattenedContext{
+		DistinctIDContextKey: "12345",
+		GroupsContextKey:     posthog.Groups{"company": "acme"},
+	})
+	assert.Equal(t, "acme", res.Value)
+	assert.Equal(t, openfeature.TargetingMatchReason, res.Reason)
+	assert.Equal(t, 2, client.calls)
+}
+
+func TestProvider_CacheSkipsErrors(t *testing.T) {
+	client := &flakyClient{
+		Client:   posthogtest.NewClient(posthogtest.Flag{Key: "string-flag", Value: "posthog"}),
+		failures: 1,
+		err:      errors.New("unexpected status code from /decide/: 503"),
+	}
+	p := NewProvider(client, WithCache(CacheConfig{SoftTTL: time.Minute}))
+	evalCtx := openfeature.FlattenedContext{DistinctIDContextKey: "12345"}
+
+	res := p.StringEvaluation(context.Background(), "string-flag", "default", evalCtx)
+	assert.Equal(t, "default", res.Value)
+
+	res = p.StringEvaluation(context.Background(), "string-flag", "default", evalCtx)
+	assert.Equal(t, "posthog", res.Value)
+	assert.Equal(t, openfeature.TargetingMatchReason, res.Reason)
+}
+
+func TestProvider_CacheEvictsLeastRecentlyUsed(t *testing.T) {
+	client := &flakyClient{Client: posthogtest.NewClient(posthogtest.Flag{Key: "string-flag", Value: "posthog"})}
+	p := NewProvider(client, WithCache(CacheConfig{SoftTTL: time.Minute, MaxEntries: 2}))
+	evaluate := func(distinctID string) openfeature.StringResolutionDetail {
+		return p.StringEvaluation(context.Background(), "string-flag", "default", openfeature.FlattenedContext{
+			DistinctIDContextKey: distinctID,
+		})
+	}
+
+	evaluate("1")
+	evaluate("2")
+	// Serving a result from the cache marks it as recently used.
+	assert.Equal(t, openfeature.CachedReason, evaluate("1").Reason)
+	evaluate("3")
+	assert.Equal(t, 3, client.calls)
+	assert.Len(t, p.cache.entries, 2)
+
+	assert.Equal(t, openfeature.CachedReason, evaluate("1").Reason)
+	assert.Equal(t, openfeature.CachedReason, evaluate("3").Reason)
+	assert.Equal(t, openfeature.TargetingMatchReason, evaluate("2").Reason)
+	assert.Equal(t, 4, client.calls)
+}
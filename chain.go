@@ -0,0 +1,168 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"errors"
+
+	"github.com/open-feature/go-sdk/openfeature"
+)
+
+// ChainSourceMetadataKey is the key of the flag metadata recording the name of the provider in the chain which
+// resolved the flag.
+const ChainSourceMetadataKey = "chain_source"
+
+var (
+	_ openfeature.FeatureProvider = (*ChainProvider)(nil)
+	_ openfeature.StateHandler    = (*ChainProvider)(nil)
+	_ openfeature.EventHandler    = (*ChainProvider)(nil)
+)
+
+// ChainProvider evaluates flags with the PostHog provider first and falls through the fallback providers, in order,
+// whenever a provider fails to resolve a flag, e.g. because it was not found or PostHog could not be reached. The name
+// of the provider which resolved the flag is recorded in the flag metadata with ChainSourceMetadataKey. The metadata of
+// the providers, e.g. the source of overridden values recorded with SourceMetadataKey, is kept. If no provider
+// resolves the flag, the result of the PostHog provider is returned.
+//
+// Note that PostHog cannot distinguish disabled from missing flags, boolean flags are therefore always resolved by
+// the PostHog provider unless it fails.
+type ChainProvider struct {
+	primary   *Provider
+	providers []openfeature.FeatureProvider
+}
+
+// NewChainProvider creates a new provider evaluating flags with the PostHog provider first and the fallback
+// providers afterwards.
+func NewChainProvider(provider *Provider, fallbacks ...openfeature.FeatureProvider) *ChainProvider {
+	return &ChainProvider{
+		primary:   provider,
+		providers: append([]openfeature.FeatureProvider{provider}, fallbacks...),
+	}
+}
+
+// Metadata returns the providers metadata.
+func (p *ChainProvider) Metadata() openfeature.Metadata {
+	return openfeature.Metadata{
+		Name: "PostHogChain",
+	}
+}
+
+// Hooks returns the hooks of all chained providers.
+func (p *ChainProvider) Hooks() []openfeature.Hook {
+	hooks := []openfeature.Hook{}
+	for _, provider := range p.providers {
+		hooks = append(hooks, provider.Hooks()...)
+	}
+	return hooks
+}
+
+// EventChannel returns the event channel of the PostHog provider.
+func (p *ChainProvider) EventChannel() <-chan openfeature.Event {
+	return p.primary.EventChannel()
+}
+
+// Init initializes all chained providers.
+func (p *ChainProvider) Init(evalCtx openfeature.EvaluationContext) error {
+	var errs []error
+	for _, provider := range p.providers {
+		if handler, ok := provider.(openfeature.StateHandler); ok {
+			errs = append(errs, handler.Init(evalCtx))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Shutdown shuts down all chained providers.
+func (p *ChainProvider) Shutdown() {
+	for _, provider := range p.providers {
+		if handler, ok := provider.(openfeature.StateHandler); ok {
+			handler.Shutdown()
+		}
+	}
+}
+
+// Status returns the state of the PostHog provider.
+func (p *ChainProvider) Status() openfeature.State {
+	return p.primary.Status()
+}
+
+func (p *ChainProvider) BooleanEvaluation(ctx context.Context, flag string, defaultValue bool, evalCtx openfeature.FlattenedContext) openfeature.BoolResolutionDetail {
+	value, detail := resolveChain(p.providers, func(provider openfeature.FeatureProvider) (bool, openfeature.ProviderResolutionDetail) {
+		res := provider.BooleanEvaluation(ctx, flag, defaultValue, evalCtx)
+		return res.Value, res.ProviderResolutionDetail
+	})
+	return openfeature.BoolResolutionDetail{Value: value, ProviderResolutionDetail: detail}
+}
+
+func (p *ChainProvider) FloatEvaluation(ctx context.Context, flag string, defaultValue float64, evalCtx openfeature.FlattenedContext) openfeature.FloatResolutionDetail {
+	value, detail := resolveChain(p.providers, func(provider openfeature.FeatureProvider) (float64, openfeature.ProviderResolutionDetail) {
+		res := provider.FloatEvaluation(ctx, flag, defaultValue, evalCtx)
+		return res.Value, res.ProviderResolutionDetail
+	})
+	return openfeature.FloatResolutionDetail{Value: value, ProviderResolutionDetail: detail}
+}
+
+func (p *ChainProvider) IntEvaluation(ctx context.Context, flag string, defaultValue int64, evalCtx openfeature.FlattenedContext) openfeature.IntResolutionDetail {
+	value, detail := resolveChain(p.providers, func(provider openfeature.FeatureProvider) (int64, openfeature.ProviderResolutionDetail) {
+		res := provider.IntEvaluation(ctx, flag, defaultValue, evalCtx)
+		return res.Value, res.ProviderResolutionDetail
+	})
+	return openfeature.IntResolutionDetail{Value: value, ProviderResolutionDetail: detail}
+}
+
+func (p *ChainProvider) ObjectEvaluation(ctx context.Context, flag string, defaultValue interface{}, evalCtx openfeature.FlattenedContext) openfeature.InterfaceResolutionDetail {
+	value, detail := resolveChain(p.providers, func(provider openfeature.FeatureProvider) (interface{}, openfeature.ProviderResolutionDetail) {
+		res := provider.ObjectEvaluation(ctx, flag, defaultValue, evalCtx)
+		return res.Value, res.ProviderResolutionDetail
+	})
+	return openfeature.InterfaceResolutionDetail{Value: value, ProviderResolutionDetail: detail}
+}
+
+func (p *ChainProvider) StringEvaluation(ctx context.Context, flag string, defaultValue string, evalCtx openfeature.FlattenedContext) openfeature.StringResolutionDetail {
+	value, detail := resolveChain(p.providers, func(provider openfeature.FeatureProvider) (string, openfeature.ProviderResolutionDetail) {
+		res := provider.StringEvaluation(ctx, flag, defaultValue, evalCtx)
+		return res.Value, res.ProviderResolutionDetail
+	})
+	return openfeature.StringResolutionDetail{Value: value, ProviderResolutionDetail: detail}
+}
+
+// resolveChain evaluates the providers in order and returns the first successful result with its source recorded.
+// If all providers fail, the result of the first provider is returned.
+func resolveChain[T any](providers []openfeature.FeatureProvider,
+	evaluate func(openfeature.FeatureProvider) (T, openfeature.ProviderResolutionDetail)) (T, openfeature.ProviderResolutionDetail) {
+	var firstValue T
+	var firstDetail openfeature.ProviderResolutionDetail
+	for i, provider := range providers {
+		value, detail := evaluate(provider)
+		if detail.Error() == nil {
+			return value, withSource(detail, provider.Metadata().Name)
+		}
+		if i == 0 {
+			firstValue, firstDetail = value, withSource(detail, provider.Metadata().Name)
+		}
+	}
+	return firstValue, firstDetail
+}
+
+func withSource(detail openfeature.ProviderResolutionDetail, source string) openfeature.ProviderResolutionDetail {
+	metadata := make(openfeature.FlagMetadata, len(detail.FlagMetadata)+1)
+	for key, value := range detail.FlagMetadata {
+		metadata[key] = value
+	}
+	metadata[ChainSourceMetadataKey] = source
+	detail.FlagMetadata = metadata
+	return detail
+}
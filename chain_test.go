@@ -0,0 +1,136 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/open-feature/go-sdk/openfeature/memprovider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"string-flag": "file", "file-flag": "file", "int-flag": "invalid"}`), 0o600))
+	file, err := NewFileProvider(path)
+	require.NoError(t, err)
+
+	memory := memprovider.NewInMemoryProvider(map[string]memprovider.InMemoryFlag{
+		"memory-flag": {
+			State:          memprovider.Enabled,
+			DefaultVariant: "on",
+			Variants:       map[string]interface{}{"on": "memory"},
+		},
+		"int-flag": {
+			State:          memprovider.Enabled,
+			DefaultVariant: "on",
+			Variants:       map[string]interface{}{"on": 20},
+		},
+	})
+
+	client := posthogtest.NewFaultyClient(posthogtest.NewClient(
+		posthogtest.Flag{Key: "string-flag", Value: "posthog"},
+		posthogtest.Flag{Key: "int-flag", Value: "not a number"},
+	), posthogtest.Faults{})
+	p := NewChainProvider(NewProvider(client), file, memory)
+	evalCtx := openfeature.FlattenedContext{DistinctIDContextKey: "12345"}
+
+	tcs := map[string]struct {
+		flag     string
+		faults   posthogtest.Faults
+		expected string
+		source   string
+		err      bool
+	}{
+		"resolved by PostHog": {
+			flag:     "string-flag",
+			expected: "posthog",
+			source:   "PostHog",
+		},
+		"PostHog unreachable": {
+			flag:     "string-flag",
+			faults:   posthogtest.Faults{ErrorRate: 1},
+			expected: "file",
+			source:   "File",
+		},
+		"not found in PostHog": {
+			flag:     "file-flag",
+			expected: "file",
+			source:   "File",
+		},
+		"not found in file": {
+			flag:     "memory-flag",
+			expected: "memory",
+			source:   "InMemoryProvider",
+		},
+		"not found anywhere": {
+			flag:     "unknown-flag",
+			expected: "default",
+			source:   "PostHog",
+			err:      true,
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			client.SetFaults(tc.faults)
+
+			res := p.StringEvaluation(context.Background(), tc.flag, "default", evalCtx)
+			assert.Equal(t, tc.expected, res.Value)
+			assert.Equal(t, tc.source, res.FlagMetadata[ChainSourceMetadataKey])
+			assert.Equal(t, tc.err, res.Error() != nil)
+		})
+	}
+
+	t.Run("type mismatch", func(t *testing.T) {
+		client.SetFaults(posthogtest.Faults{})
+
+		res := p.IntEvaluation(context.Background(), "int-flag", 10, evalCtx)
+		assert.Equal(t, int64(20), res.Value)
+		assert.Equal(t, "InMemoryProvider", res.FlagMetadata[ChainSourceMetadataKey])
+	})
+}
+
+func TestChainProvider_KeepsOverrideSource(t *testing.T) {
+	t.Setenv(LocalOverrideEnvPrefix+"STRING_FLAG", "override")
+	p := NewChainProvider(NewProvider(posthogtest.NewClient(), WithLocalOverrides("")), NewStaticProvider(nil))
+
+	res := p.StringEvaluation(context.Background(), "string-flag", "default", openfeature.FlattenedContext{DistinctIDContextKey: "12345"})
+	assert.Equal(t, "override", res.Value)
+	assert.Equal(t, openfeature.FlagMetadata{
+		SourceMetadataKey:      LocalOverrideEnvPrefix + "STRING_FLAG",
+		ChainSourceMetadataKey: "PostHog",
+	}, res.FlagMetadata)
+}
+
+func TestChainProvider_Init(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "definitions.json")
+	client := &loadingClient{
+		flakyClient: &flakyClient{Client: posthogtest.NewClient()},
+		release:     make(chan struct{}),
+	}
+	p := NewChainProvider(NewProvider(client, WithDefinitionsSnapshot(path)), NewStaticProvider(nil))
+
+	require.NoError(t, p.Init(openfeature.EvaluationContext{}))
+	close(client.release)
+	<-p.primary.snapshot.loaded
+	assert.FileExists(t, path)
+}
@@ -0,0 +1,217 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/posthog/posthog-go"
+)
+
+// Defaults of the CircuitBreakerConfig.
+const (
+	DefaultFailureThreshold = 5
+	DefaultOpenTimeout      = 30 * time.Second
+)
+
+var errCircuitOpen = errors.New("circuit breaker is open, PostHog is not called")
+
+// CircuitBreakerConfig configures the circuit breaker guarding the calls to PostHog.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures after which the circuit opens.
+	// Defaults to DefaultFailureThreshold.
+	FailureThreshold int
+	// OpenTimeout is the duration the circuit stays open before a single probe call is let through.
+	// Defaults to DefaultOpenTimeout.
+	OpenTimeout time.Duration
+	// Timeout after which a call to PostHog is abandoned and counted as failure. Abandoned calls continue in the
+	// background, since the PostHog client is not context aware. With a timeout, calls are also bound by the evaluation
+	// context. Zero disables the timeout, PostHog is then called directly.
+	Timeout time.Duration
+}
+
+// WithCircuitBreaker guards the calls to PostHog with a circuit breaker. After FailureThreshold consecutive failures
+// the circuit opens and evaluations resolve to their default value with an error, or to the last known value if
+// WithFallbackStore is used, without calling PostHog. Once the OpenTimeout passed, a single probe call is let through
+// which either closes the circuit again or keeps it open.
+//
+// A PROVIDER_ERROR event is emitted when the circuit opens and a PROVIDER_READY event when it closes again. Until then,
+// the provider reports the error state.
+func WithCircuitBreaker(config CircuitBreakerConfig) Option {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = DefaultFailureThreshold
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = DefaultOpenTimeout
+	}
+
+	return func(p *Provider) {
+		p.breaker = &circuitBreaker{
+			config: config,
+			now:    time.Now,
+			state:  circuitClosed,
+			onStateChange: func(from, to circuitState) {
+				details := openfeature.ProviderEventDetails{
+					Message:       fmt.Sprintf("circuit breaker changed from %s to %s", from, to),
+					EventMetadata: map[string]interface{}{"circuit_breaker": string(to)},
+				}
+				// Failed probes re-open the circuit from half-open, which is not reported again.
+				switch {
+				case from == circuitClosed && to == circuitOpen:
+					p.emit(openfeature.ProviderError, details)
+				case to == circuitClosed:
+					p.emit(openfeature.ProviderReady, details)
+				}
+			},
+		}
+	}
+}
+
+type circuitState string
+
+const (
+	circuitClosed   circuitState = "closed"
+	circuitOpen     circuitState = "open"
+	circuitHalfOpen circuitState = "half-open"
+)
+
+type circuitBreaker struct {
+	config        CircuitBreakerConfig
+	now           func() time.Time
+	onStateChange func(from, to circuitState)
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// allow returns errCircuitOpen if the call must not be made.
+func (cb *circuitBreaker) allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case circuitOpen:
+		if cb.now().Sub(cb.openedAt) < cb.config.OpenTimeout {
+			return errCircuitOpen
+		}
+		cb.setState(circuitHalfOpen)
+		cb.probing = true
+		return nil
+	case circuitHalfOpen:
+		// Only a single probe is let through at a time.
+		if cb.probing {
+			return errCircuitOpen
+		}
+		cb.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// record records the result of a call which was allowed.
+func (cb *circuitBreaker) record(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.probing = false
+	if err == nil {
+		cb.failures = 0
+		if cb.state != circuitClosed {
+			cb.setState(circuitClosed)
+		}
+		return
+	}
+	if !isFailure(err) {
+		return
+	}
+
+	cb.failures++
+	if cb.state == circuitHalfOpen || cb.failures >= cb.config.FailureThreshold {
+		cb.openedAt = cb.now()
+		if cb.state != circuitOpen {
+			cb.setState(circuitOpen)
+		}
+	}
+}
+
+// closed reports whether the circuit is closed. A half-open circuit is not closed until its probe succeeded.
+func (cb *circuitBreaker) closed() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state == circuitClosed
+}
+
+func (cb *circuitBreaker) setState(state circuitState) {
+	from := cb.state
+	cb.state = state
+	if cb.onStateChange != nil {
+		cb.onStateChange(from, state)
+	}
+}
+
+// isFailure reports whether the error indicates PostHog being unavailable. Invalid requests and calls canceled by the
+// caller neither count as failure nor as success.
+func isFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var configErr posthog.ConfigError
+	return !errors.As(err, &configErr)
+}
+
+// callWithContext calls fn and returns early with the context's error once the context is done. Since the PostHog
+// client is not context aware, the call itself continues in the background.
+func callWithContext(ctx context.Context, fn func() (interface{}, error)) (interface{}, error) {
+	if ctx.Done() == nil {
+		return callRecovered(fn)
+	}
+
+	type result struct {
+		res interface{}
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		res, err := callRecovered(fn)
+		done <- result{res: res, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.res, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// callRecovered calls fn and returns a panic of the PostHog client as error.
+func callRecovered(fn func() (interface{}, error)) (res interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			res, err = nil, fmt.Errorf("PostHog client panicked: %v", r)
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,138 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_CircuitBreaker(t *testing.T) {
+	fake := posthogtest.NewClient(posthogtest.Flag{Key: "string-flag", Value: "posthog"})
+	client := posthogtest.NewFaultyClient(fake, posthogtest.Faults{ErrorRate: 1})
+	p := NewProvider(client, WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute}))
+
+	now := time.Now()
+	p.breaker.now = func() time.Time { return now }
+	evalCtx := openfeature.FlattenedContext{DistinctIDContextKey: "12345"}
+
+	// The circuit opens after two consecutive failures.
+	for i := 0; i < 2; i++ {
+		res := p.StringEvaluation(context.Background(), "string-flag", "default", evalCtx)
+		assert.Equal(t, "default", res.Value)
+		assert.Contains(t, res.ResolutionError.Error(), posthogtest.ErrInjected.Error())
+	}
+	assertEvent(t, p, openfeature.ProviderError)
+	assert.Equal(t, openfeature.ErrorState, p.Status())
+
+	// PostHog is not called while the circuit is open.
+	client.SetFaults(posthogtest.Faults{})
+	res := p.StringEvaluation(context.Background(), "string-flag", "default", evalCtx)
+	assert.Equal(t, "default", res.Value)
+	assert.Equal(t, openfeature.ErrorReason, res.Reason)
+	assert.Contains(t, res.ResolutionError.Error(), errCircuitOpen.Error())
+	assert.Empty(t, fake.Events())
+
+	// A failing probe keeps the circuit open.
+	client.SetFaults(posthogtest.Faults{ErrorRate: 1})
+	now = now.Add(time.Minute)
+	res = p.StringEvaluation(context.Background(), "string-flag", "default", evalCtx)
+	assert.Contains(t, res.ResolutionError.Error(), posthogtest.ErrInjected.Error())
+	res = p.StringEvaluation(context.Background(), "string-flag", "default", evalCtx)
+	assert.Contains(t, res.ResolutionError.Error(), errCircuitOpen.Error())
+	assert.Equal(t, openfeature.ErrorState, p.Status())
+
+	// A successful probe closes the circuit.
+	client.SetFaults(posthogtest.Faults{})
+	now = now.Add(time.Minute)
+	res = p.StringEvaluation(context.Background(), "string-flag", "default", evalCtx)
+	assert.Equal(t, "posthog", res.Value)
+	assert.Equal(t, openfeature.TargetingMatchReason, res.Reason)
+	assertEvent(t, p, openfeature.ProviderReady)
+	assert.Equal(t, openfeature.ReadyState, p.Status())
+}
+
+func TestProvider_CircuitBreakerTimeout(t *testing.T) {
+	client := posthogtest.NewFaultyClient(
+		posthogtest.NewClient(posthogtest.Flag{Key: "string-flag", Value: "posthog"}),
+		posthogtest.Faults{Latency: time.Second},
+	)
+	p := NewProvider(client, WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, Timeout: 10 * time.Millisecond}))
+
+	start := time.Now()
+	res := p.StringEvaluation(context.Background(), "string-flag", "default", openfeature.FlattenedContext{DistinctIDContextKey: "12345"})
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, "default", res.Value)
+	assert.Contains(t, res.ResolutionError.Error(), context.DeadlineExceeded.Error())
+	assertEvent(t, p, openfeature.ProviderError)
+}
+
+func TestProvider_ClientPanics(t *testing.T) {
+	tcs := map[string][]Option{
+		"without circuit breaker":      nil,
+		"circuit breaker":              {WithCircuitBreaker(CircuitBreakerConfig{})},
+		"circuit breaker with timeout": {WithCircuitBreaker(CircuitBreakerConfig{Timeout: time.Second})},
+	}
+
+	for name, opts := range tcs {
+		t.Run(name, func(t *testing.T) {
+			client := posthogtest.NewFaultyClient(
+				posthogtest.NewClient(posthogtest.Flag{Key: "string-flag", Value: "posthog"}),
+				posthogtest.Faults{PanicRate: 1},
+			)
+			p := NewProvider(client, opts...)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			res := p.StringEvaluation(ctx, "string-flag", "default", openfeature.FlattenedContext{DistinctIDContextKey: "12345"})
+			assert.Equal(t, "default", res.Value)
+			assert.Equal(t, openfeature.ErrorReason, res.Reason)
+			assert.Contains(t, res.ResolutionError.Error(), "PostHog client panicked: "+posthogtest.ErrInjected.Error())
+		})
+	}
+}
+
+func TestProvider_CallsClientDirectly(t *testing.T) {
+	client := posthogtest.NewFaultyClient(
+		posthogtest.NewClient(posthogtest.Flag{Key: "string-flag", Value: "posthog"}),
+		posthogtest.Faults{Latency: 10 * time.Millisecond},
+	)
+	p := NewProvider(client, WithCircuitBreaker(CircuitBreakerConfig{}))
+
+	// Without a timeout of the circuit breaker, the call is not abandoned once the context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res := p.StringEvaluation(ctx, "string-flag", "default", openfeature.FlattenedContext{DistinctIDContextKey: "12345"})
+	assert.Equal(t, "posthog", res.Value)
+	assert.NoError(t, res.Error())
+}
+
+func assertEvent(t *testing.T, p *Provider, eventType openfeature.EventType) {
+	t.Helper()
+
+	select {
+	case event := <-p.EventChannel():
+		require.Equal(t, eventType, event.EventType)
+		assert.Equal(t, "PostHog", event.ProviderName)
+	default:
+		t.Fatalf("expected %s event", eventType)
+	}
+}
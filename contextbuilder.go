@@ -0,0 +1,138 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/posthog/posthog-go"
+)
+
+// ContextBuilder builds evaluation contexts in the shape expected by the Provider, e.g.
+//
+//	evalCtx := NewContext("12345").
+//		WithGroup("company", "acme").
+//		WithPersonProperty("plan", "pro").
+//		WithGroupProperty("company", "size", 50).
+//		Build()
+type ContextBuilder struct {
+	distinctID       string
+	groups           posthog.Groups
+	personProperties posthog.Properties
+	groupProperties  map[string]posthog.Properties
+	attributes       map[string]interface{}
+}
+
+// NewContext creates a new builder for an evaluation context of the distinct ID.
+func NewContext(distinctID string) *ContextBuilder {
+	return &ContextBuilder{distinctID: distinctID}
+}
+
+// WithGroup adds the group of the given type, e.g. WithGroup("company", "acme").
+func (b *ContextBuilder) WithGroup(groupType, key string) *ContextBuilder {
+	if b.groups == nil {
+		b.groups = posthog.Groups{}
+	}
+	b.groups[groupType] = key
+	return b
+}
+
+// WithPersonProperty adds the person property.
+func (b *ContextBuilder) WithPersonProperty(key string, value interface{}) *ContextBuilder {
+	if b.personProperties == nil {
+		b.personProperties = posthog.Properties{}
+	}
+	b.personProperties[key] = value
+	return b
+}
+
+// WithPersonProperties adds all person properties.
+func (b *ContextBuilder) WithPersonProperties(properties posthog.Properties) *ContextBuilder {
+	for key, value := range properties {
+		b.WithPersonProperty(key, value)
+	}
+	return b
+}
+
+// WithGroupProperty adds the property of the group of the given type.
+func (b *ContextBuilder) WithGroupProperty(groupType, key string, value interface{}) *ContextBuilder {
+	if b.groupProperties == nil {
+		b.groupProperties = map[string]posthog.Properties{}
+	}
+	if b.groupProperties[groupType] == nil {
+		b.groupProperties[groupType] = posthog.Properties{}
+	}
+	b.groupProperties[groupType][key] = value
+	return b
+}
+
+// WithGroupProperties adds all properties per group type.
+func (b *ContextBuilder) WithGroupProperties(properties map[string]posthog.Properties) *ContextBuilder {
+	for groupType, groupProperties := range properties {
+		for key, value := range groupProperties {
+			b.WithGroupProperty(groupType, key, value)
+		}
+	}
+	return b
+}
+
+// WithAttribute adds an attribute not interpreted by the Provider, e.g. for hooks or other providers.
+// Attributes named like the keys used by the Provider are overwritten by Build.
+func (b *ContextBuilder) WithAttribute(key string, value interface{}) *ContextBuilder {
+	if b.attributes == nil {
+		b.attributes = map[string]interface{}{}
+	}
+	b.attributes[key] = value
+	return b
+}
+
+// Build returns the evaluation context. The builder may be reused, later changes do not affect contexts already built.
+func (b *ContextBuilder) Build() openfeature.EvaluationContext {
+	attributes := make(map[string]interface{}, len(b.attributes)+2)
+	for key, value := range b.attributes {
+		attributes[key] = value
+	}
+
+	if len(b.groups) > 0 {
+		groups := make(posthog.Groups, len(b.groups))
+		for groupType, key := range b.groups {
+			groups[groupType] = key
+		}
+		attributes[GroupsContextKey] = groups
+	}
+
+	if len(b.personProperties) > 0 || len(b.groupProperties) > 0 {
+		var properties PostHogProperties
+		if len(b.personProperties) > 0 {
+			properties.PersonProperties = copyProperties(b.personProperties)
+		}
+		if len(b.groupProperties) > 0 {
+			properties.GroupProperties = make(map[string]posthog.Properties, len(b.groupProperties))
+			for groupType, groupProperties := range b.groupProperties {
+				properties.GroupProperties[groupType] = copyProperties(groupProperties)
+			}
+		}
+		attributes[PropertiesContextKey] = properties
+	}
+
+	return openfeature.NewEvaluationContext(b.distinctID, attributes)
+}
+
+func copyProperties(properties posthog.Properties) posthog.Properties {
+	copied := make(posthog.Properties, len(properties))
+	for key, value := range properties {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,97 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/posthog/posthog-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextBuilder(t *testing.T) {
+	tcs := map[string]struct {
+		builder  *ContextBuilder
+		expected posthog.FeatureFlagPayload
+	}{
+		"distinct ID only": {
+			builder:  NewContext("12345"),
+			expected: posthog.FeatureFlagPayload{Key: "flag", DistinctId: "12345"},
+		},
+		"groups and properties": {
+			builder: NewContext("12345").
+				WithGroup("company", "acme").
+				WithPersonProperty("plan", "pro").
+				WithGroupProperty("company", "size", 50).
+				WithAttribute("region", "eu"),
+			expected: posthog.FeatureFlagPayload{
+				Key:              "flag",
+				DistinctId:       "12345",
+				Groups:           posthog.Groups{"company": "acme"},
+				PersonProperties: posthog.Properties{"plan": "pro"},
+				GroupProperties:  map[string]posthog.Properties{"company": {"size": 50}},
+			},
+		},
+		"group properties only": {
+			builder: NewContext("12345").
+				WithGroupProperties(map[string]posthog.Properties{"company": {"size": 50}}),
+			expected: posthog.FeatureFlagPayload{
+				Key:             "flag",
+				DistinctId:      "12345",
+				GroupProperties: map[string]posthog.Properties{"company": {"size": 50}},
+			},
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			payload, err := translateFeatureFlagPayload(flattenContext(tc.builder.Build()), "flag")
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, payload)
+		})
+	}
+}
+
+func TestContextBuilder_Reuse(t *testing.T) {
+	builder := NewContext("12345").WithPersonProperty("plan", "free")
+	free := builder.Build()
+	pro := builder.WithPersonProperty("plan", "pro").WithGroup("company", "acme").Build()
+
+	assert.Equal(t, PostHogProperties{PersonProperties: posthog.Properties{"plan": "free"}}, free.Attribute(PropertiesContextKey))
+	assert.Nil(t, free.Attribute(GroupsContextKey))
+	assert.Equal(t, PostHogProperties{PersonProperties: posthog.Properties{"plan": "pro"}}, pro.Attribute(PropertiesContextKey))
+}
+
+func TestContextBuilder_Evaluation(t *testing.T) {
+	client := WithOverrides(t, NewProvider(posthogtest.NewClient(posthogtest.Flag{
+		Key:   "string-flag",
+		Value: "control",
+		Rules: []posthogtest.Rule{{
+			Groups:          posthog.Groups{"company": "acme"},
+			GroupProperties: map[string]posthog.Properties{"company": {"size": 50}},
+			Value:           "enterprise",
+		}},
+	})), nil)
+
+	value, err := client.StringValue(context.Background(), "string-flag", "default", NewContext("12345").
+		WithGroup("company", "acme").
+		WithGroupProperty("company", "size", 50).
+		Build())
+	require.NoError(t, err)
+	assert.Equal(t, "enterprise", value)
+}
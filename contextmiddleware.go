@@ -0,0 +1,106 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/posthog/posthog-go"
+)
+
+var errMissingDistinctIDExtractor = errors.New("missing distinct ID extractor")
+
+// RequestExtractor extracts a value from the request. An empty value means the request does not carry it.
+type RequestExtractor func(r *http.Request) string
+
+// HeaderExtractor extracts the value of the request header.
+func HeaderExtractor(name string) RequestExtractor {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// PathExtractor extracts the value of the path wildcard matched by the http.ServeMux, see http.Request.PathValue.
+func PathExtractor(name string) RequestExtractor {
+	return func(r *http.Request) string {
+		return r.PathValue(name)
+	}
+}
+
+// CookieExtractor extracts the value of the cookie.
+func CookieExtractor(name string) RequestExtractor {
+	return func(r *http.Request) string {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+}
+
+// ContextMiddlewareConfig configures how the evaluation context is extracted from requests.
+type ContextMiddlewareConfig struct {
+	// DistinctID extracts the distinct ID. Required.
+	DistinctID RequestExtractor
+	// Groups extracts the group key per group type, e.g. {"organization": PathExtractor("org")}.
+	Groups map[string]RequestExtractor
+	// PersonProperties extracts the person properties.
+	PersonProperties func(r *http.Request) posthog.Properties
+	// GroupProperties extracts the group properties per group type.
+	GroupProperties func(r *http.Request) map[string]posthog.Properties
+}
+
+// NewContextMiddleware creates net/http middleware storing an OpenFeature transaction context in the request's
+// context, populated with the distinct ID, groups and properties extracted from the request. Attributes of a
+// transaction context already present are kept unless overwritten. Requests without a distinct ID are served
+// unchanged.
+func NewContextMiddleware(config ContextMiddlewareConfig) (func(http.Handler) http.Handler, error) {
+	if config.DistinctID == nil {
+		return nil, errMissingDistinctIDExtractor
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if evalCtx, ok := config.extract(r); ok {
+				r = r.WithContext(openfeature.MergeTransactionContext(r.Context(), evalCtx))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+func (c ContextMiddlewareConfig) extract(r *http.Request) (openfeature.EvaluationContext, bool) {
+	distinctID := c.DistinctID(r)
+	if distinctID == "" {
+		return openfeature.EvaluationContext{}, false
+	}
+
+	builder := NewContext(distinctID)
+	for groupType, extract := range c.Groups {
+		if key := extract(r); key != "" {
+			builder.WithGroup(groupType, key)
+		}
+	}
+	if c.PersonProperties != nil {
+		builder.WithPersonProperties(c.PersonProperties(r))
+	}
+	if c.GroupProperties != nil {
+		builder.WithGroupProperties(c.GroupProperties(r))
+	}
+
+	return builder.Build(), true
+}
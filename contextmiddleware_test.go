@@ -0,0 +1,139 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/posthog/posthog-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextMiddleware(t *testing.T) {
+	middleware, err := NewContextMiddleware(ContextMiddlewareConfig{
+		DistinctID: HeaderExtractor("X-User-ID"),
+		Groups: map[string]RequestExtractor{
+			"organization": PathExtractor("org"),
+			"team":         CookieExtractor("team"),
+		},
+		PersonProperties: func(r *http.Request) posthog.Properties {
+			return posthog.Properties{"plan": r.Header.Get("X-Plan")}
+		},
+		GroupProperties: func(r *http.Request) map[string]posthog.Properties {
+			return map[string]posthog.Properties{"organization": {"region": "eu"}}
+		},
+	})
+	require.NoError(t, err)
+
+	var evalCtx openfeature.EvaluationContext
+	mux := http.NewServeMux()
+	mux.Handle("/orgs/{org}", middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		evalCtx = openfeature.TransactionContext(r.Context())
+	})))
+
+	tcs := map[string]struct {
+		header   http.Header
+		cookie   *http.Cookie
+		expected openfeature.EvaluationContext
+	}{
+		"full context": {
+			header: http.Header{"X-User-Id": {"12345"}, "X-Plan": {"pro"}},
+			cookie: &http.Cookie{Name: "team", Value: "platform"},
+			expected: openfeature.NewEvaluationContext("12345", map[string]interface{}{
+				GroupsContextKey: posthog.Groups{"organization": "acme", "team": "platform"},
+				PropertiesContextKey: PostHogProperties{
+					PersonProperties: posthog.Properties{"plan": "pro"},
+					GroupProperties:  map[string]posthog.Properties{"organization": {"region": "eu"}},
+				},
+			}),
+		},
+		"missing cookie": {
+			header: http.Header{"X-User-Id": {"12345"}, "X-Plan": {"free"}},
+			expected: openfeature.NewEvaluationContext("12345", map[string]interface{}{
+				GroupsContextKey: posthog.Groups{"organization": "acme"},
+				PropertiesContextKey: PostHogProperties{
+					PersonProperties: posthog.Properties{"plan": "free"},
+					GroupProperties:  map[string]posthog.Properties{"organization": {"region": "eu"}},
+				},
+			}),
+		},
+		"missing distinct ID": {
+			expected: openfeature.EvaluationContext{},
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/orgs/acme", nil)
+			req.Header = tc.header
+			if req.Header == nil {
+				req.Header = http.Header{}
+			}
+			if tc.cookie != nil {
+				req.AddCookie(tc.cookie)
+			}
+
+			mux.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tc.expected, evalCtx)
+		})
+	}
+}
+
+func TestContextMiddleware_Evaluation(t *testing.T) {
+	provider := NewProvider(posthogtest.NewClient(posthogtest.Flag{
+		Key:   "string-flag",
+		Value: "control",
+		Rules: []posthogtest.Rule{{Groups: posthog.Groups{"organization": "acme"}, Value: "acme"}},
+	}))
+	require.NoError(t, openfeature.SetNamedProviderAndWait(t.Name(), provider))
+	t.Cleanup(func() {
+		_ = openfeature.SetNamedProviderAndWait(t.Name(), openfeature.NoopProvider{})
+	})
+	client := openfeature.NewClient(t.Name())
+
+	middleware, err := NewContextMiddleware(ContextMiddlewareConfig{
+		DistinctID: HeaderExtractor("X-User-ID"),
+		Groups:     map[string]RequestExtractor{"organization": HeaderExtractor("X-Org")},
+	})
+	require.NoError(t, err)
+
+	var value string
+	var evalCtx openfeature.EvaluationContext
+	handler := middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		value, _ = client.StringValue(r.Context(), "string-flag", "default", openfeature.EvaluationContext{})
+		evalCtx = openfeature.TransactionContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-User-ID", "12345")
+	req.Header.Set("X-Org", "acme")
+	upstream := openfeature.NewTargetlessEvaluationContext(map[string]interface{}{"region": "eu"})
+	req = req.WithContext(openfeature.WithTransactionContext(req.Context(), upstream))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "acme", value)
+	// Attributes of an upstream transaction context are kept.
+	assert.Equal(t, "eu", evalCtx.Attribute("region"))
+}
+
+func TestNewContextMiddleware_MissingDistinctID(t *testing.T) {
+	_, err := NewContextMiddleware(ContextMiddlewareConfig{})
+	assert.ErrorIs(t, err, errMissingDistinctIDExtractor)
+}
@@ -0,0 +1,279 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/open-feature/go-sdk/openfeature"
+)
+
+// StaleReason is reported for values which were not evaluated by PostHog but served from the last known good values.
+const StaleReason openfeature.Reason = "STALE"
+
+var (
+	_ FallbackStore = (*MemoryFallbackStore)(nil)
+	_ FallbackStore = (*FileFallbackStore)(nil)
+)
+
+// FallbackStore keeps the last successfully evaluated value per flag and distinct ID.
+// Implementations must be safe for concurrent use.
+type FallbackStore interface {
+	// Load returns the last value stored for the flag and distinct ID.
+	Load(flag, distinctID string) (interface{}, bool)
+	// Store stores the value successfully evaluated for the flag and distinct ID.
+	Store(flag, distinctID string, value interface{})
+}
+
+// WithFallbackStore stores every successfully evaluated value in the store. When PostHog cannot be reached, including
+// while the circuit breaker is open, the last known value is served with the StaleReason instead of the default value.
+// The values of bulk evaluations are stored as a single entry per distinct ID.
+func WithFallbackStore(store FallbackStore) Option {
+	return func(p *Provider) {
+		p.fallback = store
+	}
+}
+
+// Defaults of the FallbackStoreConfig.
+const (
+	DefaultFallbackMaxEntries    = 10000
+	DefaultFallbackFlushInterval = time.Second
+)
+
+// FallbackStoreConfig configures the fallback stores.
+type FallbackStoreConfig struct {
+	// MaxEntries is the maximum number of values kept. Once exceeded, the least recently used values are evicted.
+	// Defaults to DefaultFallbackMaxEntries.
+	MaxEntries int
+	// FlushInterval is the delay after which changed values are persisted by the FileFallbackStore, so that bursts of
+	// changes are written at once and off the evaluation path. Defaults to DefaultFallbackFlushInterval.
+	FlushInterval time.Duration
+}
+
+func (c FallbackStoreConfig) withDefaults() FallbackStoreConfig {
+	if c.MaxEntries <= 0 {
+		c.MaxEntries = DefaultFallbackMaxEntries
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = DefaultFallbackFlushInterval
+	}
+	return c
+}
+
+type fallbackKey struct {
+	flag       string
+	distinctID string
+}
+
+type fallbackEntry struct {
+	key   fallbackKey
+	value interface{}
+}
+
+// MemoryFallbackStore is an in-memory FallbackStore keeping the most recently used values.
+type MemoryFallbackStore struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[fallbackKey]*list.Element
+	// order lists the entries from the most to the least recently used.
+	order *list.List
+}
+
+// NewMemoryFallbackStore creates a new, empty in-memory fallback store.
+func NewMemoryFallbackStore(config FallbackStoreConfig) *MemoryFallbackStore {
+	return &MemoryFallbackStore{
+		maxEntries: config.withDefaults().MaxEntries,
+		entries:    make(map[fallbackKey]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Load returns the last value stored for the flag and distinct ID.
+func (s *MemoryFallbackStore) Load(flag, distinctID string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[fallbackKey{flag: flag, distinctID: distinctID}]
+	if !ok {
+		return nil, false
+	}
+	s.order.MoveToFront(element)
+	return element.Value.(*fallbackEntry).value, true
+}
+
+// Store stores the value for the flag and distinct ID.
+func (s *MemoryFallbackStore) Store(flag, distinctID string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store(flag, distinctID, value)
+}
+
+// store stores the value and reports whether the stored values changed. The caller must hold the lock.
+func (s *MemoryFallbackStore) store(flag, distinctID string, value interface{}) bool {
+	key := fallbackKey{flag: flag, distinctID: distinctID}
+	if element, ok := s.entries[key]; ok {
+		s.order.MoveToFront(element)
+		entry := element.Value.(*fallbackEntry)
+		if reflect.DeepEqual(entry.value, value) {
+			return false
+		}
+		entry.value = value
+		return true
+	}
+
+	s.entries[key] = s.order.PushFront(&fallbackEntry{key: key, value: value})
+	for s.order.Len() > s.maxEntries {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*fallbackEntry).key)
+	}
+	return true
+}
+
+// values returns the stored values per flag and distinct ID. The caller must hold the lock.
+func (s *MemoryFallbackStore) values() map[string]map[string]interface{} {
+	values := make(map[string]map[string]interface{})
+	for key, element := range s.entries {
+		if values[key.flag] == nil {
+			values[key.flag] = make(map[string]interface{})
+		}
+		values[key.flag][key.distinctID] = element.Value.(*fallbackEntry).value
+	}
+	return values
+}
+
+// FileFallbackStore is a FallbackStore persisting the values as JSON file, so they survive restarts.
+// Changed values are persisted in the background after the FlushInterval, call Flush to persist them immediately,
+// e.g. on shutdown.
+type FileFallbackStore struct {
+	path          string
+	flushInterval time.Duration
+	memory        *MemoryFallbackStore
+
+	mu        sync.Mutex
+	scheduled bool
+	err       error
+
+	// writeMu serializes the writes of the file.
+	writeMu sync.Mutex
+}
+
+// NewFileFallbackStore creates a new fallback store persisted at path. Values already persisted at path are loaded.
+func NewFileFallbackStore(path string, config FallbackStoreConfig) (*FileFallbackStore, error) {
+	config = config.withDefaults()
+	s := &FileFallbackStore{
+		path:          path,
+		flushInterval: config.FlushInterval,
+		memory:        NewMemoryFallbackStore(config),
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]map[string]interface{}
+	if err := json.Unmarshal(b, &values); err != nil {
+		return nil, fmt.Errorf("parsing fallback store %q: %w", path, err)
+	}
+	for flag, byDistinctID := range values {
+		for distinctID, value := range byDistinctID {
+			s.memory.store(flag, distinctID, value)
+		}
+	}
+	return s, nil
+}
+
+// Load returns the last value stored for the flag and distinct ID.
+func (s *FileFallbackStore) Load(flag, distinctID string) (interface{}, bool) {
+	return s.memory.Load(flag, distinctID)
+}
+
+// Store stores the value for the flag and distinct ID. If it changed, the values are persisted after the
+// FlushInterval. Errors while persisting are reported by Err.
+func (s *FileFallbackStore) Store(flag, distinctID string, value interface{}) {
+	s.memory.mu.Lock()
+	changed := s.memory.store(flag, distinctID, value)
+	s.memory.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.scheduled {
+		s.scheduled = true
+		time.AfterFunc(s.flushInterval, func() { _ = s.Flush() })
+	}
+}
+
+// Flush persists the values immediately.
+func (s *FileFallbackStore) Flush() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	// Changes stored from now on are persisted by the next flush.
+	s.mu.Lock()
+	s.scheduled = false
+	s.mu.Unlock()
+
+	s.memory.mu.Lock()
+	b, err := json.Marshal(s.memory.values())
+	s.memory.mu.Unlock()
+	if err == nil {
+		err = writeFileAtomic(s.path, b)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+	return err
+}
+
+// Err returns the error of the last attempt to persist the values, if any.
+func (s *FileFallbackStore) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// writeFileAtomic writes the file via a temporary file, so readers never see a partially written file.
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,136 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_FallbackStore(t *testing.T) {
+	stores := map[string]func(t *testing.T) FallbackStore{
+		"memory": func(*testing.T) FallbackStore {
+			return NewMemoryFallbackStore(FallbackStoreConfig{})
+		},
+		"file": func(t *testing.T) FallbackStore {
+			store, err := NewFileFallbackStore(filepath.Join(t.TempDir(), "fallback.json"), FallbackStoreConfig{FlushInterval: time.Hour})
+			require.NoError(t, err)
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			client := posthogtest.NewFaultyClient(posthogtest.NewClient(
+				posthogtest.Flag{Key: "bool-flag", Value: true},
+				posthogtest.Flag{Key: "int-flag", Value: "20"},
+			), posthogtest.Faults{})
+			p := NewProvider(client, WithFallbackStore(newStore(t)))
+			evalCtx := openfeature.FlattenedContext{DistinctIDContextKey: "12345"}
+
+			b := p.BooleanEvaluation(context.Background(), "bool-flag", false, evalCtx)
+			assert.True(t, b.Value)
+			assert.Equal(t, openfeature.TargetingMatchReason, b.Reason)
+			i := p.IntEvaluation(context.Background(), "int-flag", 10, evalCtx)
+			assert.Equal(t, int64(20), i.Value)
+
+			client.SetFaults(posthogtest.Faults{ErrorRate: 1})
+
+			b = p.BooleanEvaluation(context.Background(), "bool-flag", false, evalCtx)
+			assert.True(t, b.Value)
+			assert.Equal(t, StaleReason, b.Reason)
+			assert.Equal(t, openfeature.ResolutionError{}, b.ResolutionError)
+			i = p.IntEvaluation(context.Background(), "int-flag", 10, evalCtx)
+			assert.Equal(t, int64(20), i.Value)
+			assert.Equal(t, StaleReason, i.Reason)
+
+			// Without a last known value for the distinct ID, the default is returned.
+			i = p.IntEvaluation(context.Background(), "int-flag", 10, openfeature.FlattenedContext{DistinctIDContextKey: "67890"})
+			assert.Equal(t, int64(10), i.Value)
+			assert.Equal(t, openfeature.ErrorReason, i.Reason)
+		})
+	}
+}
+
+func TestMemoryFallbackStore_MaxEntries(t *testing.T) {
+	store := NewMemoryFallbackStore(FallbackStoreConfig{MaxEntries: 2})
+	store.Store("flag", "1", true)
+	store.Store("flag", "2", true)
+	// Loading a value marks it as recently used.
+	_, ok := store.Load("flag", "1")
+	require.True(t, ok)
+	store.Store("flag", "3", true)
+
+	_, ok = store.Load("flag", "1")
+	assert.True(t, ok)
+	_, ok = store.Load("flag", "2")
+	assert.False(t, ok)
+	_, ok = store.Load("flag", "3")
+	assert.True(t, ok)
+}
+
+func TestFileFallbackStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fallback.json")
+
+	store, err := NewFileFallbackStore(path, FallbackStoreConfig{FlushInterval: time.Hour})
+	require.NoError(t, err)
+	store.Store("bool-flag", "12345", true)
+	store.Store("string-flag", "12345", "variant")
+
+	// Values are not persisted on the evaluation path.
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	require.NoError(t, store.Flush())
+	require.NoError(t, store.Err())
+
+	// The values survive a restart.
+	store, err = NewFileFallbackStore(path, FallbackStoreConfig{})
+	require.NoError(t, err)
+	value, ok := store.Load("bool-flag", "12345")
+	assert.True(t, ok)
+	assert.Equal(t, true, value)
+	value, ok = store.Load("string-flag", "12345")
+	assert.True(t, ok)
+	assert.Equal(t, "variant", value)
+	_, ok = store.Load("string-flag", "67890")
+	assert.False(t, ok)
+
+	// Only the most recently used values are loaded.
+	store, err = NewFileFallbackStore(path, FallbackStoreConfig{MaxEntries: 1})
+	require.NoError(t, err)
+	assert.Len(t, store.memory.entries, 1)
+}
+
+func TestFileFallbackStore_BackgroundFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fallback.json")
+
+	store, err := NewFileFallbackStore(path, FallbackStoreConfig{FlushInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	store.Store("bool-flag", "12345", true)
+
+	assert.Eventually(t, func() bool {
+		b, err := os.ReadFile(path)
+		return err == nil && string(b) == `{"bool-flag":{"12345":true}}`
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, store.Err())
+}
@@ -0,0 +1,155 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Defaults of OverrideMiddlewareConfig.
+const (
+	DefaultOverrideHeader = "X-PostHog-Flag-Overrides"
+	DefaultOverrideCookie = "posthog_flag_overrides"
+)
+
+// RequestOverrideSource is the source recorded in the flag metadata for values overridden for a single request.
+const RequestOverrideSource = "request"
+
+var (
+	errMissingSecret = errors.New("missing secret for signing flag overrides")
+	errInvalidToken  = errors.New("invalid flag overrides token")
+	errExpiredToken  = errors.New("expired flag overrides token")
+)
+
+type requestOverridesKey struct{}
+
+// OverrideMiddlewareConfig configures the middleware reading flag overrides from requests.
+type OverrideMiddlewareConfig struct {
+	// Secret is the key the override tokens are signed with, see SignOverrides. Required.
+	Secret []byte
+	// Header is the name of the request header carrying the token. Defaults to DefaultOverrideHeader.
+	Header string
+	// Cookie is the name of the cookie carrying the token. Defaults to DefaultOverrideCookie.
+	// The header takes precedence over the cookie.
+	Cookie string
+}
+
+type overrideToken struct {
+	Flags     map[string]interface{} `json:"flags"`
+	ExpiresAt int64                  `json:"exp"`
+}
+
+// NewOverrideMiddleware creates net/http middleware forcing flag values for single requests, e.g. to let QA exercise
+// every variant in staging without editing targeting rules. The overrides are read from a token created by
+// SignOverrides in a request header or cookie. Requests without a valid token are served unchanged.
+//
+// The overrides are injected into the request's context, evaluations with that context return the forced values
+// with the OverrideReason and RequestOverrideSource in the flag metadata with SourceMetadataKey.
+func NewOverrideMiddleware(config OverrideMiddlewareConfig) (func(http.Handler) http.Handler, error) {
+	if len(config.Secret) == 0 {
+		return nil, errMissingSecret
+	}
+	if config.Header == "" {
+		config.Header = DefaultOverrideHeader
+	}
+	if config.Cookie == "" {
+		config.Cookie = DefaultOverrideCookie
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get(config.Header)
+			if token == "" {
+				if cookie, err := r.Cookie(config.Cookie); err == nil {
+					token = cookie.Value
+				}
+			}
+			if token != "" {
+				if overrides, err := verifyOverrides(config.Secret, token, time.Now()); err == nil {
+					r = r.WithContext(ContextWithOverrides(r.Context(), overrides))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// SignOverrides creates a token for the middleware created by NewOverrideMiddleware, forcing the flag values until
+// the token expires. Values may be booleans, strings, numbers or JSON-encodable objects.
+func SignOverrides(secret []byte, overrides map[string]interface{}, expiresAt time.Time) (string, error) {
+	if len(secret) == 0 {
+		return "", errMissingSecret
+	}
+
+	b, err := json.Marshal(overrideToken{Flags: overrides, ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return "", fmt.Errorf("encoding flag overrides: %w", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(sign(secret, payload)), nil
+}
+
+func verifyOverrides(secret []byte, token string, now time.Time) (map[string]interface{}, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errInvalidToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, sign(secret, payload)) {
+		return nil, errInvalidToken
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	var decoded overrideToken
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return nil, errInvalidToken
+	}
+	if !now.Before(time.Unix(decoded.ExpiresAt, 0)) {
+		return nil, errExpiredToken
+	}
+	return decoded.Flags, nil
+}
+
+func sign(secret []byte, payload string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+// ContextWithOverrides returns a copy of ctx forcing the flag values for all evaluations with it, e.g. to apply
+// overrides in middleware of other protocols than HTTP. Values may be booleans, strings, numbers or JSON-encodable
+// objects.
+func ContextWithOverrides(ctx context.Context, overrides map[string]interface{}) context.Context {
+	return context.WithValue(ctx, requestOverridesKey{}, normalizeBootstrapValues(overrides))
+}
+
+// requestOverride returns the value forced for the flag by ContextWithOverrides.
+func requestOverride(ctx context.Context, flag string) (interface{}, bool) {
+	overrides, _ := ctx.Value(requestOverridesKey{}).(map[string]interface{})
+	value, ok := overrides[flag]
+	return value, ok
+}
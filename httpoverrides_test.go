@@ -0,0 +1,115 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverrideMiddleware(t *testing.T) {
+	secret := []byte("secret")
+	p := NewProvider(posthogtest.NewClient(
+		posthogtest.Flag{Key: "string-flag", Value: "control"},
+		posthogtest.Flag{Key: "int-flag", Value: "10"},
+	))
+	middleware, err := NewOverrideMiddleware(OverrideMiddlewareConfig{Secret: secret})
+	require.NoError(t, err)
+
+	var res openfeature.StringResolutionDetail
+	handler := middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		res = p.StringEvaluation(r.Context(), "string-flag", "default", openfeature.FlattenedContext{
+			DistinctIDContextKey: "12345",
+		})
+	}))
+
+	valid, err := SignOverrides(secret, map[string]interface{}{"string-flag": "test"}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	expired, err := SignOverrides(secret, map[string]interface{}{"string-flag": "test"}, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	forged, err := SignOverrides([]byte("other"), map[string]interface{}{"string-flag": "test"}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	tcs := map[string]struct {
+		header   string
+		cookie   string
+		expected string
+		reason   openfeature.Reason
+	}{
+		"header": {
+			header:   valid,
+			expected: "test",
+			reason:   OverrideReason,
+		},
+		"cookie": {
+			cookie:   valid,
+			expected: "test",
+			reason:   OverrideReason,
+		},
+		"no token": {
+			expected: "control",
+			reason:   openfeature.TargetingMatchReason,
+		},
+		"expired token": {
+			header:   expired,
+			expected: "control",
+			reason:   openfeature.TargetingMatchReason,
+		},
+		"forged token": {
+			header:   forged,
+			expected: "control",
+			reason:   openfeature.TargetingMatchReason,
+		},
+		"malformed token": {
+			cookie:   "not-a-token",
+			expected: "control",
+			reason:   openfeature.TargetingMatchReason,
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				req.Header.Set(DefaultOverrideHeader, tc.header)
+			}
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: DefaultOverrideCookie, Value: tc.cookie})
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tc.expected, res.Value)
+			assert.Equal(t, tc.reason, res.Reason)
+			if tc.reason == OverrideReason {
+				assert.Equal(t, openfeature.FlagMetadata{SourceMetadataKey: RequestOverrideSource}, res.FlagMetadata)
+			}
+		})
+	}
+}
+
+func TestNewOverrideMiddleware_MissingSecret(t *testing.T) {
+	_, err := NewOverrideMiddleware(OverrideMiddlewareConfig{})
+	assert.ErrorIs(t, err, errMissingSecret)
+
+	_, err = SignOverrides(nil, map[string]interface{}{"string-flag": "test"}, time.Now())
+	assert.ErrorIs(t, err, errMissingSecret)
+}
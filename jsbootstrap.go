@@ -0,0 +1,63 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/open-feature/go-sdk/openfeature"
+)
+
+// JSBootstrap is the bootstrap object accepted by posthog-js, see https://posthog.com/docs/feature-flags/bootstrapping.
+// Encoded with encoding/json, it is safe to embed into HTML script elements.
+type JSBootstrap struct {
+	DistinctID string `json:"distinctID"`
+	// IsIdentifiedID marks the distinct ID as identified user, as opposed to an anonymous one.
+	IsIdentifiedID      bool                       `json:"isIdentifiedID,omitempty"`
+	FeatureFlags        map[string]interface{}     `json:"featureFlags"`
+	FeatureFlagPayloads map[string]json.RawMessage `json:"featureFlagPayloads"`
+}
+
+// NewJSBootstrap evaluates all flags for the evaluation context server-side with EvaluateAll and returns them as
+// bootstrap object for posthog-js, so frontends have the flags available at first paint and consistent with the server.
+// Payloads which are not valid JSON are encoded as strings.
+func NewJSBootstrap(ctx context.Context, provider *Provider, evalCtx openfeature.EvaluationContext) (JSBootstrap, error) {
+	evalCtx = withTransactionContext(ctx, evalCtx)
+	flags, err := provider.EvaluateAll(ctx, evalCtx)
+	if err != nil {
+		return JSBootstrap{}, err
+	}
+
+	bootstrap := JSBootstrap{
+		DistinctID:          evalCtx.TargetingKey(),
+		FeatureFlags:        make(map[string]interface{}, len(flags)),
+		FeatureFlagPayloads: make(map[string]json.RawMessage),
+	}
+	for key, flag := range flags {
+		bootstrap.FeatureFlags[key] = flag.Value
+		if flag.Payload == "" {
+			continue
+		}
+		if json.Valid([]byte(flag.Payload)) {
+			bootstrap.FeatureFlagPayloads[key] = json.RawMessage(flag.Payload)
+			continue
+		}
+		if b, err := json.Marshal(flag.Payload); err == nil {
+			bootstrap.FeatureFlagPayloads[key] = b
+		}
+	}
+	return bootstrap, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewJSBootstrap(t *testing.T) {
+	p := NewProvider(posthogtest.NewClient(
+		posthogtest.Flag{Key: "bool-flag", Value: true},
+		posthogtest.Flag{Key: "variant-flag", Value: "test", Payload: `{"color": "red"}`},
+		posthogtest.Flag{Key: "text-flag", Value: true, Payload: "</script>"},
+		posthogtest.Flag{Key: "disabled-flag"},
+	))
+
+	bootstrap, err := NewJSBootstrap(context.Background(), p, NewContext("12345").Build())
+	require.NoError(t, err)
+	bootstrap.IsIdentifiedID = true
+
+	b, err := json.Marshal(bootstrap)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"distinctID": "12345",
+		"isIdentifiedID": true,
+		"featureFlags": {"bool-flag": true, "variant-flag": "test", "text-flag": true, "disabled-flag": false},
+		"featureFlagPayloads": {"variant-flag": {"color": "red"}, "text-flag": "</script>"}
+	}`, string(b))
+	assert.NotContains(t, string(b), "</script>")
+
+	_, err = NewJSBootstrap(context.Background(), p, openfeature.EvaluationContext{})
+	assert.ErrorIs(t, err, errMissingTargetKey)
+}
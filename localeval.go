@@ -0,0 +1,217 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"crypto/sha1" //nolint:gosec // Used for bucketing, mirroring PostHog's hashing.
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/posthog/posthog-go"
+)
+
+// Local evaluation of flag definitions, mirroring the evaluation of the PostHog client. Only the subset not requiring
+// additional state is supported: definitions using cohorts, group aggregation or experience continuity are
+// inconclusive and must be evaluated by PostHog.
+
+const longScale = 0xfffffffffffffff
+
+var errInconclusive = errors.New("flag cannot be evaluated locally")
+
+// evaluateLocally evaluates the flag definition for the distinct ID and person properties. The result is either a
+// boolean or the key of the matching variant.
+func evaluateLocally(flag posthog.FeatureFlag, distinctID string, properties posthog.Properties) (interface{}, error) {
+	if flag.EnsureExperienceContinuity != nil && *flag.EnsureExperienceContinuity {
+		return nil, errInconclusive
+	}
+	if !flag.Active {
+		return false, nil
+	}
+	if flag.Filters.AggregationGroupTypeIndex != nil {
+		return nil, errInconclusive
+	}
+
+	// Conditions with variant overrides are evaluated first.
+	conditions := append([]posthog.FeatureFlagCondition(nil), flag.Filters.Groups...)
+	sort.SliceStable(conditions, func(i, j int) bool {
+		return conditions[i].Variant != nil && conditions[j].Variant == nil
+	})
+
+	inconclusive := false
+	for _, condition := range conditions {
+		match, err := matchCondition(flag.Key, distinctID, condition, properties)
+		if errors.Is(err, errInconclusive) {
+			inconclusive = true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			continue
+		}
+
+		if condition.Variant != nil && hasVariant(flag, *condition.Variant) {
+			return *condition.Variant, nil
+		}
+		return matchingVariant(flag, distinctID), nil
+	}
+
+	if inconclusive {
+		return nil, errInconclusive
+	}
+	return false, nil
+}
+
+func matchCondition(key, distinctID string, condition posthog.FeatureFlagCondition, properties posthog.Properties) (bool, error) {
+	for _, property := range condition.Properties {
+		if property.Type == "cohort" {
+			return false, errInconclusive
+		}
+		match, err := matchProperty(property, properties)
+		if err != nil || !match {
+			return false, err
+		}
+	}
+
+	if len(condition.Properties) > 0 && condition.RolloutPercentage != nil {
+		return true, nil
+	}
+	if condition.RolloutPercentage != nil {
+		return bucket(key, distinctID, "") <= float64(*condition.RolloutPercentage)/100, nil
+	}
+	return true, nil
+}
+
+func matchProperty(property posthog.FlagProperty, properties posthog.Properties) (bool, error) {
+	actual, ok := properties[property.Key]
+	if !ok {
+		return false, errInconclusive
+	}
+
+	expected := property.Value
+	switch property.Operator {
+	case "exact":
+		if values, ok := expected.([]interface{}); ok {
+			return containsValue(values, actual), nil
+		}
+		return expected == actual, nil
+	case "is_not":
+		if values, ok := expected.([]interface{}); ok {
+			return !containsValue(values, actual), nil
+		}
+		return expected != actual, nil
+	case "is_set":
+		return true, nil
+	case "icontains":
+		return strings.Contains(strings.ToLower(fmt.Sprint(actual)), strings.ToLower(fmt.Sprint(expected))), nil
+	case "not_icontains":
+		return !strings.Contains(strings.ToLower(fmt.Sprint(actual)), strings.ToLower(fmt.Sprint(expected))), nil
+	case "regex", "not_regex":
+		r, err := regexp.Compile(fmt.Sprint(expected))
+		if err != nil {
+			return false, nil
+		}
+		return r.MatchString(fmt.Sprint(actual)) == (property.Operator == "regex"), nil
+	case "gt", "gte", "lt", "lte":
+		e, eErr := toFloat(expected)
+		a, aErr := toFloat(actual)
+		if eErr != nil || aErr != nil {
+			return false, fmt.Errorf("%v and %v are not orderable", expected, actual)
+		}
+		switch property.Operator {
+		case "gt":
+			return a > e, nil
+		case "gte":
+			return a >= e, nil
+		case "lt":
+			return a < e, nil
+		default:
+			return a <= e, nil
+		}
+	default:
+		return false, errInconclusive
+	}
+}
+
+func matchingVariant(flag posthog.FeatureFlag, distinctID string) interface{} {
+	if flag.Filters.Multivariate == nil {
+		return true
+	}
+
+	value := bucket(flag.Key, distinctID, "variant")
+	lower := 0.0
+	for _, variant := range flag.Filters.Multivariate.Variants {
+		if variant.RolloutPercentage == nil {
+			continue
+		}
+		upper := lower + float64(*variant.RolloutPercentage)/100
+		if value >= lower && value < upper {
+			return variant.Key
+		}
+		lower = upper
+	}
+	return true
+}
+
+func hasVariant(flag posthog.FeatureFlag, key string) bool {
+	if flag.Filters.Multivariate == nil {
+		return false
+	}
+	for _, variant := range flag.Filters.Multivariate.Variants {
+		if variant.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// bucket deterministically maps the flag and distinct ID to a value between 0 and 1.
+func bucket(key, distinctID, salt string) float64 {
+	digest := sha1.Sum([]byte(key + "." + distinctID + salt)) //nolint:gosec // See import.
+	value, _ := strconv.ParseInt(hex.EncodeToString(digest[:])[:15], 16, 64)
+	return float64(value) / longScale
+}
+
+func containsValue(values []interface{}, v interface{}) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch t := v.(type) {
+	case int:
+		return float64(t), nil
+	case int32:
+		return float64(t), nil
+	case int64:
+		return float64(t), nil
+	case float32:
+		return float64(t), nil
+	case float64:
+		return t, nil
+	default:
+		return 0, fmt.Errorf("%v is not a number", v)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/posthog/posthog-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+var localDefinitions = []posthog.FeatureFlag{
+	{
+		Key:    "rollout-flag",
+		Active: true,
+		Filters: posthog.Filter{Groups: []posthog.FeatureFlagCondition{
+			{RolloutPercentage: ptr[uint8](50)},
+		}},
+	},
+	{
+		Key:    "variant-flag",
+		Active: true,
+		Filters: posthog.Filter{
+			Groups: []posthog.FeatureFlagCondition{
+				{RolloutPercentage: ptr[uint8](100)},
+				{
+					Properties: []posthog.FlagProperty{{Key: "plan", Operator: "exact", Value: "enterprise"}},
+					Variant:    ptr("test"),
+				},
+			},
+			Multivariate: &posthog.Variants{Variants: []posthog.FlagVariant{
+				{Key: "control", RolloutPercentage: ptr[uint8](50)},
+				{Key: "test", RolloutPercentage: ptr[uint8](25)},
+				{Key: "holdout", RolloutPercentage: ptr[uint8](25)},
+			}},
+		},
+	},
+	{
+		Key:    "property-flag",
+		Active: true,
+		Filters: posthog.Filter{Groups: []posthog.FeatureFlagCondition{{
+			Properties: []posthog.FlagProperty{
+				{Key: "seats", Operator: "gte", Value: 10},
+				{Key: "email", Operator: "icontains", Value: "@EXAMPLE.com"},
+			},
+		}}},
+	},
+	{
+		Key:     "inactive-flag",
+		Filters: posthog.Filter{Groups: []posthog.FeatureFlagCondition{{RolloutPercentage: ptr[uint8](100)}}},
+	},
+}
+
+func TestEvaluateLocally(t *testing.T) {
+	tcs := map[string]struct {
+		flag       string
+		properties posthog.Properties
+		expected   interface{}
+		err        error
+	}{
+		"variant override": {
+			flag:       "variant-flag",
+			properties: posthog.Properties{"plan": "enterprise"},
+			expected:   "test",
+		},
+		"matching properties": {
+			flag:       "property-flag",
+			properties: posthog.Properties{"seats": 12, "email": "jane@example.com"},
+			expected:   true,
+		},
+		"non-matching properties": {
+			flag:       "property-flag",
+			properties: posthog.Properties{"seats": 5, "email": "jane@example.com"},
+			expected:   false,
+		},
+		"missing properties": {
+			flag: "property-flag",
+			err:  errInconclusive,
+		},
+		"inactive flag": {
+			flag:     "inactive-flag",
+			expected: false,
+		},
+		"experience continuity": {
+			flag: "continuity-flag",
+			err:  errInconclusive,
+		},
+		"cohort": {
+			flag: "cohort-flag",
+			err:  errInconclusive,
+		},
+	}
+
+	flags := map[string]posthog.FeatureFlag{
+		"continuity-flag": {Key: "continuity-flag", Active: true, EnsureExperienceContinuity: ptr(true)},
+		"cohort-flag": {Key: "cohort-flag", Active: true, Filters: posthog.Filter{Groups: []posthog.FeatureFlagCondition{{
+			Properties: []posthog.FlagProperty{{Key: "id", Type: "cohort", Value: 1}},
+		}}}},
+	}
+	for _, flag := range localDefinitions {
+		flags[flag.Key] = flag
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			res, err := evaluateLocally(flags[tc.flag], "12345", tc.properties)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, res)
+		})
+	}
+}
+
+func TestEvaluateLocally_MatchesPostHog(t *testing.T) {
+	s := posthogtest.NewServer(posthogtest.ServerConfig{Definitions: localDefinitions})
+	defer s.Close()
+
+	client, err := posthog.NewWithConfig("project-key", posthog.Config{Endpoint: s.URL, PersonalApiKey: "personal-key"})
+	require.NoError(t, err)
+	defer client.Close()
+
+	for _, flag := range localDefinitions {
+		for i := 0; i < 100; i++ {
+			distinctID := fmt.Sprintf("user-%d", i)
+			properties := posthog.Properties{"seats": i % 20, "email": distinctID + "@example.com"}
+			if i%3 == 0 {
+				properties["plan"] = "enterprise"
+			}
+
+			expected, expectedErr := client.GetFeatureFlag(posthog.FeatureFlagPayload{
+				Key:                 flag.Key,
+				DistinctId:          distinctID,
+				PersonProperties:    properties,
+				OnlyEvaluateLocally: true,
+			})
+			res, err := evaluateLocally(flag, distinctID, properties)
+			if expectedErr != nil {
+				assert.ErrorIs(t, err, errInconclusive)
+				continue
+			}
+			require.NoError(t, err)
+			assert.Equal(t, expected, res, "%s for %s", flag.Key, distinctID)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/open-feature/go-sdk/openfeature"
+)
+
+// OverrideReason is reported for values overridden locally, see WithLocalOverrides.
+const OverrideReason openfeature.Reason = "OVERRIDE"
+
+// SourceMetadataKey is the key of the flag metadata recording the source of overridden values, e.g. the environment
+// variable or file of a local override, or RequestOverrideSource.
+const SourceMetadataKey = "source"
+
+// LocalOverrideEnvPrefix is the prefix of environment variables overriding flags, see WithLocalOverrides.
+const LocalOverrideEnvPrefix = "POSTHOG_FLAG_"
+
+// WithLocalOverrides lets developers override flags locally, without changing the targeting in PostHog. Overrides are
+// read once when creating the provider from
+//   - environment variables named LocalOverrideEnvPrefix followed by the flag key in upper case, with all characters
+//     other than letters and digits replaced by underscores, e.g. POSTHOG_FLAG_NEW_CHECKOUT=true for "new-checkout".
+//   - the JSON file at path, if it exists, containing a single object mapping flag keys to their values, e.g.
+//     {"new-checkout": true}. An empty path disables the file.
+//
+// Environment variables take precedence over the file, and both take precedence over PostHog. Overridden values are
+// reported with the OverrideReason and the override source in the flag metadata with SourceMetadataKey. If the file
+// cannot be loaded, Init fails.
+func WithLocalOverrides(path string) Option {
+	overrides := &localOverrides{
+		path: path,
+		env:  make(map[string]string),
+	}
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if strings.HasPrefix(name, LocalOverrideEnvPrefix) {
+			overrides.env[name] = value
+		}
+	}
+	overrides.err = overrides.loadFile()
+
+	return func(p *Provider) {
+		p.overrides = overrides
+	}
+}
+
+type localOverrides struct {
+	path string
+	env  map[string]string
+	file map[string]interface{}
+	err  error
+}
+
+func (o *localOverrides) loadFile() error {
+	if o.path == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(o.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal(b, &values); err != nil {
+		return fmt.Errorf("parsing local overrides %q: %w", o.path, err)
+	}
+	o.file = normalizeBootstrapValues(values)
+	return nil
+}
+
+// lookup returns the override of the flag and its source.
+func (o *localOverrides) lookup(flag string) (interface{}, string, bool) {
+	name := overrideEnvName(flag)
+	if value, ok := o.env[name]; ok {
+		return value, name, true
+	}
+	if value, ok := o.file[flag]; ok {
+		return value, o.path, true
+	}
+	return nil, "", false
+}
+
+// overrideEnvName returns the name of the environment variable overriding the flag.
+func overrideEnvName(flag string) string {
+	return LocalOverrideEnvPrefix + strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return '_'
+		}
+		return unicode.ToUpper(r)
+	}, flag)
+}
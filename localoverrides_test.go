@@ -0,0 +1,102 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_LocalOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.local.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"string-flag": "file",
+		"int-flag": 30,
+		"object-flag": {"enabled": true},
+		"new-checkout": false
+	}`), 0o600))
+	t.Setenv("POSTHOG_FLAG_NEW_CHECKOUT", "true")
+	t.Setenv("POSTHOG_FLAG_FLOAT_FLAG", "2.5")
+
+	p := NewProvider(posthogtest.NewClient(
+		posthogtest.Flag{Key: "string-flag", Value: "posthog"},
+		posthogtest.Flag{Key: "other-flag", Value: "posthog"},
+		posthogtest.Flag{Key: "float-flag", Value: "1.5"},
+	), WithLocalOverrides(path))
+	require.NoError(t, p.Init(openfeature.EvaluationContext{}))
+	evalCtx := openfeature.FlattenedContext{DistinctIDContextKey: "12345"}
+
+	s := p.StringEvaluation(context.Background(), "string-flag", "default", evalCtx)
+	assert.Equal(t, "file", s.Value)
+	assert.Equal(t, OverrideReason, s.Reason)
+	assert.Equal(t, openfeature.FlagMetadata{SourceMetadataKey: path}, s.FlagMetadata)
+
+	b := p.BooleanEvaluation(context.Background(), "new-checkout", false, evalCtx)
+	assert.True(t, b.Value)
+	assert.Equal(t, OverrideReason, b.Reason)
+	assert.Equal(t, openfeature.FlagMetadata{SourceMetadataKey: "POSTHOG_FLAG_NEW_CHECKOUT"}, b.FlagMetadata)
+
+	f := p.FloatEvaluation(context.Background(), "float-flag", 1, evalCtx)
+	assert.Equal(t, 2.5, f.Value)
+
+	i := p.IntEvaluation(context.Background(), "int-flag", 10, evalCtx)
+	assert.Equal(t, int64(30), i.Value)
+
+	o := p.ObjectEvaluation(context.Background(), "object-flag", nil, evalCtx)
+	assert.Equal(t, map[string]interface{}{"enabled": true}, o.Value)
+
+	// Flags without overrides are evaluated by PostHog.
+	s = p.StringEvaluation(context.Background(), "other-flag", "default", evalCtx)
+	assert.Equal(t, "posthog", s.Value)
+	assert.Equal(t, openfeature.TargetingMatchReason, s.Reason)
+}
+
+func TestProvider_LocalOverridesInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.local.json")
+	require.NoError(t, os.WriteFile(path, []byte("new-checkout=true"), 0o600))
+
+	p := NewProvider(posthogtest.NewClient(), WithLocalOverrides(path))
+	assert.Error(t, p.Init(openfeature.EvaluationContext{}))
+
+	// A missing file is not an error.
+	p = NewProvider(posthogtest.NewClient(), WithLocalOverrides(filepath.Join(t.TempDir(), "missing.json")))
+	assert.NoError(t, p.Init(openfeature.EvaluationContext{}))
+}
+
+func TestOverrideEnvName(t *testing.T) {
+	tcs := map[string]struct {
+		flag     string
+		expected string
+	}{
+		"kebab case": {flag: "new-checkout", expected: "POSTHOG_FLAG_NEW_CHECKOUT"},
+		"snake case": {flag: "new_checkout", expected: "POSTHOG_FLAG_NEW_CHECKOUT"},
+		"dots":       {flag: "checkout.v2", expected: "POSTHOG_FLAG_CHECKOUT_V2"},
+		"non-ascii":  {flag: "ünicode", expected: "POSTHOG_FLAG__NICODE"},
+		"upper case": {flag: "NEW", expected: "POSTHOG_FLAG_NEW"},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, overrideEnvName(tc.flag))
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import "encoding/json"
+
+// WithMergedDefaults deep-merges the values of object flags over the default value of the evaluation, so payloads only
+// need to contain the fields which differ from the defaults. Nested objects are merged field by field, all other values
+// of the payload, including arrays and null, replace the default. If either the value or the default is not an object,
+// the value is returned as is. Defaults given as []byte or json.RawMessage are decoded as JSON, strings are not.
+//
+// Schemas configured with WithSchema are validated against the merged value.
+func WithMergedDefaults() Option {
+	return func(p *Provider) {
+		p.mergeDefaults = true
+	}
+}
+
+// mergeObjectDefaults merges the decoded flag value over the default value if configured. The default value is not
+// modified.
+func (p *Provider) mergeObjectDefaults(value, defaultValue interface{}) interface{} {
+	if !p.mergeDefaults {
+		return value
+	}
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+
+	defaults, err := normalizeObjectDefault(defaultValue)
+	if err != nil {
+		return value
+	}
+	defaultObj, ok := defaults.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	return deepMerge(defaultObj, obj)
+}
+
+// normalizeObjectDefault normalizes the default value, which also copies it, so that e.g. structs can be merged as
+// well. Only raw JSON defaults are decoded, strings are kept as they are, as they are no objects.
+func normalizeObjectDefault(defaultValue interface{}) (interface{}, error) {
+	switch v := defaultValue.(type) {
+	case string:
+		return v, nil
+	case json.RawMessage:
+		return decodeObjectValue(string(v))
+	case []byte:
+		return decodeObjectValue(string(v))
+	default:
+		return decodeObjectValue(v)
+	}
+}
+
+// deepMerge merges src into dst and returns dst.
+func deepMerge(dst, src map[string]interface{}) map[string]interface{} {
+	for key, value := range src {
+		srcObj, srcOk := value.(map[string]interface{})
+		dstObj, dstOk := dst[key].(map[string]interface{})
+		if srcOk && dstOk {
+			dst[key] = deepMerge(dstObj, srcObj)
+			continue
+		}
+		dst[key] = value
+	}
+	return dst
+}
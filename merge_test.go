@@ -0,0 +1,138 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_MergedDefaults(t *testing.T) {
+	schema, err := ParseSchema([]byte(`{"type": "object", "required": ["timeout", "retry"]}`))
+	require.NoError(t, err)
+
+	client := posthogtest.NewClient(
+		posthogtest.Flag{Key: "config", Value: `{"retry": {"attempts": 5, "codes": ["503"]}, "region": null}`},
+		posthogtest.Flag{Key: "allowlist", Value: `["alice"]`},
+		posthogtest.Flag{Key: "config-remote", Payload: `{"timeout": 10}`},
+	)
+	p := NewProvider(client,
+		WithMergedDefaults(),
+		WithRemoteConfig(RemoteConfig{KeyPrefix: "config-"}),
+		WithSchema("config", schema),
+	)
+	evalCtx := openfeature.FlattenedContext{DistinctIDContextKey: "12345"}
+
+	defaults := func() map[string]interface{} {
+		return map[string]interface{}{
+			"timeout": 1,
+			"region":  "eu",
+			"retry":   map[string]interface{}{"attempts": 3, "backoff": "1s", "codes": []interface{}{"502", "504"}},
+		}
+	}
+
+	tcs := map[string]struct {
+		flag         string
+		defaultValue interface{}
+		expected     interface{}
+	}{
+		"nested objects": {
+			flag:         "config",
+			defaultValue: defaults(),
+			expected: map[string]interface{}{
+				"timeout": float64(1),
+				"region":  nil,
+				"retry":   map[string]interface{}{"attempts": float64(5), "backoff": "1s", "codes": []interface{}{"503"}},
+			},
+		},
+		"struct default": {
+			flag: "config",
+			defaultValue: struct {
+				Timeout int `json:"timeout"`
+			}{Timeout: 2},
+			expected: map[string]interface{}{
+				"timeout": float64(2),
+				"region":  nil,
+				"retry":   map[string]interface{}{"attempts": float64(5), "codes": []interface{}{"503"}},
+			},
+		},
+		"non-object value": {
+			flag:         "allowlist",
+			defaultValue: defaults(),
+			expected:     []interface{}{"alice"},
+		},
+		"non-object default": {
+			flag:         "config-remote",
+			defaultValue: "default",
+			expected:     map[string]interface{}{"timeout": float64(10)},
+		},
+		"string default is not decoded": {
+			flag:         "config-remote",
+			defaultValue: `{"region": "us"}`,
+			expected:     map[string]interface{}{"timeout": float64(10)},
+		},
+		"raw JSON default": {
+			flag:         "config-remote",
+			defaultValue: json.RawMessage(`{"region": "us"}`),
+			expected:     map[string]interface{}{"timeout": float64(10), "region": "us"},
+		},
+		"bytes default": {
+			flag:         "config-remote",
+			defaultValue: []byte(`{"timeout": 1, "region": "us"}`),
+			expected:     map[string]interface{}{"timeout": float64(10), "region": "us"},
+		},
+		"remote config": {
+			flag:         "config-remote",
+			defaultValue: defaults(),
+			expected: map[string]interface{}{
+				"timeout": float64(10),
+				"region":  "eu",
+				"retry":   map[string]interface{}{"attempts": float64(3), "backoff": "1s", "codes": []interface{}{"502", "504"}},
+			},
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			res := p.ObjectEvaluation(context.Background(), tc.flag, tc.defaultValue, evalCtx)
+			require.NoError(t, res.Error())
+			assert.Equal(t, tc.expected, res.Value)
+		})
+	}
+
+	t.Run("default is not modified", func(t *testing.T) {
+		defaultValue := defaults()
+		p.ObjectEvaluation(context.Background(), "config", defaultValue, evalCtx)
+		assert.Equal(t, defaults(), defaultValue)
+	})
+
+	t.Run("schema validates merged value", func(t *testing.T) {
+		res := p.ObjectEvaluation(context.Background(), "config", map[string]interface{}{}, evalCtx)
+		assert.EqualError(t, res.Error(), `TYPE_MISMATCH: value of "config" violates schema: $: missing required property "timeout"`)
+	})
+}
+
+func TestProvider_WithoutMergedDefaults(t *testing.T) {
+	p := NewProvider(posthogtest.NewClient(posthogtest.Flag{Key: "config", Value: `{"retry": 5}`}))
+
+	res := p.ObjectEvaluation(context.Background(), "config", map[string]interface{}{"timeout": 1}, openfeature.FlattenedContext{DistinctIDContextKey: "12345"})
+	assert.Equal(t, map[string]interface{}{"retry": float64(5)}, res.Value)
+}
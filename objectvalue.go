@@ -0,0 +1,81 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/open-feature/go-sdk/openfeature"
+)
+
+// DecodeOption configures how ObjectValueAs decodes flag values.
+type DecodeOption func(*decodeConfig)
+
+type decodeConfig struct {
+	disallowUnknownFields bool
+}
+
+// DisallowUnknownFields makes ObjectValueAs fail if the flag value contains fields which are not part of the target
+// type, e.g. to detect typos in payloads edited in PostHog.
+func DisallowUnknownFields() DecodeOption {
+	return func(c *decodeConfig) {
+		c.disallowUnknownFields = true
+	}
+}
+
+// ObjectValueAs evaluates the object flag and decodes its value into T, using the same rules as encoding/json. If the
+// evaluation fails, the default value is returned with the error. If the value cannot be decoded into T, the default
+// value is returned with a TYPE_MISMATCH resolution error.
+func ObjectValueAs[T any](ctx context.Context, client openfeature.IClient, flag string, defaultValue T, evalCtx openfeature.EvaluationContext, options ...DecodeOption) (T, error) {
+	var config decodeConfig
+	for _, option := range options {
+		option(&config)
+	}
+
+	details, err := client.ObjectValueDetails(ctx, flag, defaultValue, evalCtx)
+	if err != nil {
+		return defaultValue, err
+	}
+	if v, ok := details.Value.(T); ok {
+		return v, nil
+	}
+
+	value, err := decodeObject[T](details.Value, config)
+	if err != nil {
+		return defaultValue, openfeature.NewTypeMismatchResolutionError(fmt.Sprintf("decoding %q into %T: %v", flag, defaultValue, err))
+	}
+	return value, nil
+}
+
+// decodeObject decodes the evaluated value into T by round-tripping it through JSON.
+func decodeObject[T any](v interface{}, config decodeConfig) (T, error) {
+	var value T
+	b, err := json.Marshal(v)
+	if err != nil {
+		return value, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	if config.disallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(&value); err != nil {
+		return *new(T), err
+	}
+	return value, nil
+}
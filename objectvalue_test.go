@@ -0,0 +1,96 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type serviceConfig struct {
+	Timeout int `json:"timeout"`
+	Retry   struct {
+		Attempts int      `json:"attempts"`
+		Codes    []string `json:"codes"`
+	} `json:"retry"`
+}
+
+func TestObjectValueAs(t *testing.T) {
+	provider := NewProvider(posthogtest.NewClient(
+		posthogtest.Flag{Key: "config", Value: `{"timeout": 5, "retry": {"attempts": 3, "codes": ["503"]}}`},
+		posthogtest.Flag{Key: "config-unknown-field", Value: `{"timeout": 5, "timeotu": 10}`},
+		posthogtest.Flag{Key: "config-wrong-type", Value: `{"timeout": "5s"}`},
+	))
+	require.NoError(t, openfeature.SetNamedProviderAndWait(t.Name(), provider))
+	t.Cleanup(func() {
+		_ = openfeature.SetNamedProviderAndWait(t.Name(), openfeature.NoopProvider{})
+	})
+	client := openfeature.NewClient(t.Name())
+	evalCtx := openfeature.NewEvaluationContext("12345", nil)
+
+	expected := serviceConfig{Timeout: 5}
+	expected.Retry.Attempts = 3
+	expected.Retry.Codes = []string{"503"}
+	defaultValue := serviceConfig{Timeout: 1}
+
+	tcs := map[string]struct {
+		flag      string
+		options   []DecodeOption
+		expected  serviceConfig
+		errorCode openfeature.ErrorCode
+	}{
+		"nested struct": {
+			flag:     "config",
+			expected: expected,
+		},
+		"unknown field": {
+			flag:     "config-unknown-field",
+			expected: serviceConfig{Timeout: 5},
+		},
+		"disallowed unknown field": {
+			flag:      "config-unknown-field",
+			options:   []DecodeOption{DisallowUnknownFields()},
+			expected:  defaultValue,
+			errorCode: openfeature.TypeMismatchCode,
+		},
+		"wrong type": {
+			flag:      "config-wrong-type",
+			expected:  defaultValue,
+			errorCode: openfeature.TypeMismatchCode,
+		},
+		"missing flag": {
+			flag:      "missing",
+			expected:  defaultValue,
+			errorCode: openfeature.FlagNotFoundCode,
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			value, err := ObjectValueAs(context.Background(), client, tc.flag, defaultValue, evalCtx, tc.options...)
+			assert.Equal(t, tc.expected, value)
+			if tc.errorCode == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, string(tc.errorCode))
+		})
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/posthog/posthog-go"
+)
+
+// Error codes of the OpenFeature Remote Evaluation Protocol.
+const (
+	ofrepParseError          = "PARSE_ERROR"
+	ofrepTargetingKeyMissing = "TARGETING_KEY_MISSING"
+	ofrepInvalidContext      = "INVALID_CONTEXT"
+	ofrepGeneral             = "GENERAL"
+)
+
+// ofrepMaxRequestSize is the maximum size of OFREP request bodies.
+const ofrepMaxRequestSize = 1 << 20
+
+// Keys of the OFREP evaluation context with a special meaning, see NewOFREPHandler.
+const (
+	ofrepTargetingKey       = "targetingKey"
+	ofrepGroupPropertiesKey = "groupProperties"
+)
+
+type ofrepRequest struct {
+	Context map[string]interface{} `json:"context"`
+}
+
+type ofrepFlag struct {
+	Key      string                   `json:"key"`
+	Value    interface{}              `json:"value"`
+	Reason   openfeature.Reason       `json:"reason,omitempty"`
+	Variant  string                   `json:"variant,omitempty"`
+	Metadata openfeature.FlagMetadata `json:"metadata,omitempty"`
+}
+
+type ofrepBulkResponse struct {
+	// Flags contains an ofrepFlag for each evaluated flag, or an ofrepError if resolving the flag failed.
+	Flags []interface{} `json:"flags"`
+}
+
+type ofrepError struct {
+	Key          string `json:"key,omitempty"`
+	ErrorCode    string `json:"errorCode,omitempty"`
+	ErrorDetails string `json:"errorDetails"`
+}
+
+// NewOFREPHandler creates an http.Handler implementing the OpenFeature Remote Evaluation Protocol (OFREP), evaluating
+// flags with the provider. It serves the single flag evaluation at POST /ofrep/v1/evaluate/flags/{key} and the bulk
+// evaluation at POST /ofrep/v1/evaluate/flags. Responses carry an ETag, requests with a matching If-None-Match header
+// are answered with 304 Not Modified.
+//
+// The evaluation context of requests is mapped as follows: the targeting key is the distinct ID, "groups" maps group
+// types to group keys, "groupProperties" maps group types to their properties and all other attributes are person
+// properties. Flags evaluate to a boolean or, for multivariate flags, the key of the variant as a string. Remote config
+// flags and flags with a schema are resolved the same way ObjectEvaluation resolves them, including merged defaults
+// and schema validation. As PostHog does not tell disabled from missing flags, unknown flags evaluate to false instead
+// of FLAG_NOT_FOUND. Both endpoints share the caching and fallbacks of the provider. Failed evaluations are answered
+// with the GENERAL error code, the cause is logged with the default slog logger.
+//
+// Authentication is not part of the handler, wrap it with the middleware of your choice.
+func NewOFREPHandler(provider *Provider) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /ofrep/v1/evaluate/flags/{key}", func(w http.ResponseWriter, r *http.Request) {
+		provider.serveOFREPFlag(w, r, r.PathValue("key"))
+	})
+	mux.HandleFunc("POST /ofrep/v1/evaluate/flags", provider.serveOFREPBulk)
+	return mux
+}
+
+func (p *Provider) serveOFREPFlag(w http.ResponseWriter, r *http.Request, key string) {
+	evalCtx, errCode, err := decodeOFREPRequest(w, r)
+	if err != nil {
+		writeOFREP(w, r, ofrepErrorStatus(err), ofrepError{Key: key, ErrorCode: errCode, ErrorDetails: err.Error()})
+		return
+	}
+
+	var res flagResult
+	if p.isRemoteConfig(key) {
+		res, err = p.getRemoteConfig(r.Context(), key)
+	} else {
+		var payload posthog.FeatureFlagPayload
+		if payload, errCode, err = toOFREPPayload(evalCtx, key); err != nil {
+			writeOFREP(w, r, http.StatusBadRequest, ofrepError{Key: key, ErrorCode: errCode, ErrorDetails: err.Error()})
+			return
+		}
+		res, err = p.getFeatureFlag(r.Context(), payload)
+	}
+	if err != nil {
+		writeOFREPFailure(w, r, key, err)
+		return
+	}
+
+	flag, resolutionErr := p.toOFREPFlag(key, res)
+	if resolutionErr != nil {
+		writeOFREP(w, r, ofrepResolutionErrorStatus(resolutionErr), resolutionErr)
+		return
+	}
+	writeOFREP(w, r, http.StatusOK, flag)
+}
+
+func (p *Provider) serveOFREPBulk(w http.ResponseWriter, r *http.Request) {
+	evalCtx, errCode, err := decodeOFREPRequest(w, r)
+	if err == nil {
+		var payload posthog.FeatureFlagPayload
+		if payload, errCode, err = toOFREPPayload(evalCtx, ""); err == nil {
+			p.serveOFREPFlags(w, r, payload)
+			return
+		}
+	}
+	writeOFREP(w, r, ofrepErrorStatus(err), ofrepError{ErrorCode: errCode, ErrorDetails: err.Error()})
+}
+
+func (p *Provider) serveOFREPFlags(w http.ResponseWriter, r *http.Request, payload posthog.FeatureFlagPayload) {
+	flags, err := p.allFlags(r.Context(), payload)
+	if err != nil {
+		writeOFREPFailure(w, r, "", err)
+		return
+	}
+
+	res := ofrepBulkResponse{Flags: make([]interface{}, 0, len(flags))}
+	for _, key := range sortedKeys(flags) {
+		flagRes := flags[key]
+		if p.isRemoteConfig(key) {
+			// Remote config flags resolve to their payload, as for single evaluations.
+			if flagRes, err = p.getRemoteConfig(r.Context(), key); err != nil {
+				res.Flags = append(res.Flags, ofrepFailure(r, key, err))
+				continue
+			}
+		}
+		if flag, resolutionErr := p.toOFREPFlag(key, flagRes); resolutionErr != nil {
+			res.Flags = append(res.Flags, resolutionErr)
+		} else {
+			res.Flags = append(res.Flags, flag)
+		}
+	}
+	writeOFREP(w, r, http.StatusOK, res)
+}
+
+// toOFREPFlag converts the evaluated flag. Remote config flags and flags with a schema are resolved as objects, which
+// may fail, all other flags keep the value returned by PostHog.
+func (p *Provider) toOFREPFlag(key string, res flagResult) (ofrepFlag, *ofrepError) {
+	flag := ofrepFlag{
+		Key:      key,
+		Value:    res.value,
+		Reason:   res.reason,
+		Metadata: res.metadata,
+	}
+	if p.isRemoteConfig(key) || p.schemas[key] != nil {
+		detail := p.resolveObject(key, res, nil)
+		if resolution := detail.ResolutionDetail(); resolution.ErrorCode != "" {
+			return ofrepFlag{}, &ofrepError{Key: key, ErrorCode: string(resolution.ErrorCode), ErrorDetails: resolution.ErrorMessage}
+		}
+		flag.Value = detail.Value
+		return flag, nil
+	}
+
+	if variant, ok := res.value.(string); ok {
+		flag.Variant = variant
+	}
+	return flag, nil
+}
+
+// decodeOFREPRequest decodes the evaluation context of the request. On failure, it returns the OFREP error code.
+// Request bodies larger than ofrepMaxRequestSize are rejected.
+func decodeOFREPRequest(w http.ResponseWriter, r *http.Request) (openfeature.FlattenedContext, string, error) {
+	var req ofrepRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, ofrepMaxRequestSize)).Decode(&req); err != nil {
+		return nil, ofrepParseError, fmt.Errorf("decoding request: %w", err)
+	}
+
+	evalCtx, err := toFlattenedContext(req.Context)
+	if err != nil {
+		return nil, ofrepInvalidContext, err
+	}
+	return evalCtx, "", nil
+}
+
+// toOFREPPayload translates the evaluation context into the payload for PostHog. On failure, it returns the OFREP
+// error code.
+func toOFREPPayload(evalCtx openfeature.FlattenedContext, key string) (posthog.FeatureFlagPayload, string, error) {
+	payload, err := translateFeatureFlagPayload(evalCtx, key)
+	if errors.Is(err, errMissingTargetKey) {
+		return posthog.FeatureFlagPayload{}, ofrepTargetingKeyMissing, err
+	}
+	if err != nil {
+		return posthog.FeatureFlagPayload{}, ofrepInvalidContext, err
+	}
+	return payload, "", nil
+}
+
+// writeOFREPFailure answers a failed evaluation with the error of ofrepFailure.
+func writeOFREPFailure(w http.ResponseWriter, r *http.Request, key string, err error) {
+	writeOFREP(w, r, http.StatusInternalServerError, ofrepFailure(r, key, err))
+}
+
+// ofrepFailure returns a generic error for the failed evaluation, as the cause may reveal internals of the provider,
+// and logs the cause instead.
+func ofrepFailure(r *http.Request, key string, err error) ofrepError {
+	slog.ErrorContext(r.Context(), "evaluating OFREP request", "flag", key, "error", err)
+	return ofrepError{Key: key, ErrorCode: ofrepGeneral, ErrorDetails: "evaluation failed"}
+}
+
+// ofrepResolutionErrorStatus returns the HTTP status of the error resolving an object flag.
+func ofrepResolutionErrorStatus(err *ofrepError) int {
+	if err.ErrorCode == string(openfeature.FlagNotFoundCode) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+// ofrepErrorStatus returns the HTTP status of the error of decodeOFREPRequest.
+func ofrepErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+func toFlattenedContext(attributes map[string]interface{}) (openfeature.FlattenedContext, error) {
+	evalCtx := openfeature.FlattenedContext{}
+	var properties PostHogProperties
+	for key, value := range attributes {
+		switch key {
+		case ofrepTargetingKey:
+			distinctID, ok := value.(string)
+			if !ok || distinctID == "" {
+				continue
+			}
+			evalCtx[DistinctIDContextKey] = distinctID
+		case GroupsContextKey:
+			groups, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, errInvalidGroups
+			}
+			evalCtx[GroupsContextKey] = posthog.Groups(groups)
+		case ofrepGroupPropertiesKey:
+			groupProperties, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, errInvalidProperties
+			}
+			properties.GroupProperties = make(map[string]posthog.Properties, len(groupProperties))
+			for groupType, value := range groupProperties {
+				groupProperties, ok := value.(map[string]interface{})
+				if !ok {
+					return nil, errInvalidProperties
+				}
+				properties.GroupProperties[groupType] = groupProperties
+			}
+		default:
+			if properties.PersonProperties == nil {
+				properties.PersonProperties = posthog.Properties{}
+			}
+			properties.PersonProperties[key] = value
+		}
+	}
+	if properties.PersonProperties != nil || properties.GroupProperties != nil {
+		evalCtx[PropertiesContextKey] = properties
+	}
+	return evalCtx, nil
+}
+
+// writeOFREP writes the JSON response with an ETag, or 304 Not Modified if the client already has it.
+func writeOFREP(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if status == http.StatusOK {
+		sum := sha256.Sum256(b)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,250 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/posthog/posthog-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOFREPHandler(t *testing.T) {
+	fake := posthogtest.NewClient(
+		posthogtest.Flag{Key: "bool-flag", Value: true},
+		posthogtest.Flag{Key: "int-flag", Value: "20"},
+		posthogtest.Flag{Key: "object-flag", Value: `{"color": "blue"}`},
+		posthogtest.Flag{Key: "invalid-object-flag", Value: "blue"},
+		posthogtest.Flag{Key: "config-service", Payload: `{"timeout": 5}`},
+		posthogtest.Flag{
+			Key:   "variant-flag",
+			Value: "control",
+			Rules: []posthogtest.Rule{
+				{Groups: posthog.Groups{"company": "acme"}, Value: "acme"},
+				{PersonProperties: posthog.Properties{"plan": "pro"}, Value: "pro"},
+			},
+		},
+	)
+	client := posthogtest.NewFaultyClient(fake, posthogtest.Faults{})
+	schema, err := ParseSchema([]byte(`{"type": "object"}`))
+	require.NoError(t, err)
+	handler := NewOFREPHandler(NewProvider(client, WithSchema("object-flag", schema), WithSchema("invalid-object-flag", schema),
+		WithRemoteConfig(RemoteConfig{KeyPrefix: "config-", Client: fake})))
+
+	tcs := map[string]struct {
+		method   string
+		path     string
+		body     string
+		faults   posthogtest.Faults
+		status   int
+		expected string
+	}{
+		"boolean flag": {
+			path:     "/ofrep/v1/evaluate/flags/bool-flag",
+			body:     `{"context": {"targetingKey": "12345"}}`,
+			status:   http.StatusOK,
+			expected: `{"key": "bool-flag", "value": true, "reason": "TARGETING_MATCH"}`,
+		},
+		"variant flag": {
+			path:     "/ofrep/v1/evaluate/flags/variant-flag",
+			body:     `{"context": {"targetingKey": "12345", "groups": {"company": "acme"}}}`,
+			status:   http.StatusOK,
+			expected: `{"key": "variant-flag", "value": "acme", "variant": "acme", "reason": "TARGETING_MATCH"}`,
+		},
+		"person properties": {
+			path:     "/ofrep/v1/evaluate/flags/variant-flag",
+			body:     `{"context": {"targetingKey": "12345", "plan": "pro"}}`,
+			status:   http.StatusOK,
+			expected: `{"key": "variant-flag", "value": "pro", "variant": "pro", "reason": "TARGETING_MATCH"}`,
+		},
+		"numeric variant": {
+			path:     "/ofrep/v1/evaluate/flags/int-flag",
+			body:     `{"context": {"targetingKey": "12345"}}`,
+			status:   http.StatusOK,
+			expected: `{"key": "int-flag", "value": "20", "variant": "20", "reason": "TARGETING_MATCH"}`,
+		},
+		"object flag": {
+			path:     "/ofrep/v1/evaluate/flags/object-flag",
+			body:     `{"context": {"targetingKey": "12345"}}`,
+			status:   http.StatusOK,
+			expected: `{"key": "object-flag", "value": {"color": "blue"}, "reason": "TARGETING_MATCH"}`,
+		},
+		"remote config without targeting key": {
+			path:     "/ofrep/v1/evaluate/flags/config-service",
+			body:     `{"context": {}}`,
+			status:   http.StatusOK,
+			expected: `{"key": "config-service", "value": {"timeout": 5}, "reason": "STATIC"}`,
+		},
+		"invalid object flag": {
+			path:     "/ofrep/v1/evaluate/flags/invalid-object-flag",
+			body:     `{"context": {"targetingKey": "12345"}}`,
+			status:   http.StatusBadRequest,
+			expected: `{"key": "invalid-object-flag", "errorCode": "TYPE_MISMATCH", "errorDetails": "invalid JSON as flag value"}`,
+		},
+		"unknown flag": {
+			path:     "/ofrep/v1/evaluate/flags/unknown-flag",
+			body:     `{"context": {"targetingKey": "12345"}}`,
+			status:   http.StatusOK,
+			expected: `{"key": "unknown-flag", "value": false, "reason": "TARGETING_MATCH"}`,
+		},
+		"missing targeting key": {
+			path:     "/ofrep/v1/evaluate/flags/bool-flag",
+			body:     `{"context": {}}`,
+			status:   http.StatusBadRequest,
+			expected: `{"key": "bool-flag", "errorCode": "TARGETING_KEY_MISSING", "errorDetails": "missing target key in evaluation context"}`,
+		},
+		"invalid context": {
+			path:     "/ofrep/v1/evaluate/flags/bool-flag",
+			body:     `{"context": {"targetingKey": "12345", "groups": "acme"}}`,
+			status:   http.StatusBadRequest,
+			expected: `{"key": "bool-flag", "errorCode": "INVALID_CONTEXT", "errorDetails": "invalid groups in evaluation context"}`,
+		},
+		"malformed request": {
+			path:   "/ofrep/v1/evaluate/flags/bool-flag",
+			body:   `{"context":`,
+			status: http.StatusBadRequest,
+		},
+		"request too large": {
+			path:   "/ofrep/v1/evaluate/flags/bool-flag",
+			body:   `{"context": {"targetingKey": "` + strings.Repeat("1", ofrepMaxRequestSize) + `"}}`,
+			status: http.StatusRequestEntityTooLarge,
+		},
+		"PostHog unreachable": {
+			path:     "/ofrep/v1/evaluate/flags/bool-flag",
+			body:     `{"context": {"targetingKey": "12345"}}`,
+			faults:   posthogtest.Faults{ErrorRate: 1},
+			status:   http.StatusInternalServerError,
+			expected: `{"key": "bool-flag", "errorCode": "GENERAL", "errorDetails": "evaluation failed"}`,
+		},
+		"bulk": {
+			path:   "/ofrep/v1/evaluate/flags",
+			body:   `{"context": {"targetingKey": "12345"}}`,
+			status: http.StatusOK,
+			expected: `{"flags": [
+				{"key": "bool-flag", "value": true, "reason": "TARGETING_MATCH"},
+				{"key": "config-service", "value": {"timeout": 5}, "reason": "STATIC"},
+				{"key": "int-flag", "value": "20", "variant": "20", "reason": "TARGETING_MATCH"},
+				{"key": "invalid-object-flag", "errorCode": "TYPE_MISMATCH", "errorDetails": "invalid JSON as flag value"},
+				{"key": "object-flag", "value": {"color": "blue"}, "reason": "TARGETING_MATCH"},
+				{"key": "variant-flag", "value": "control", "variant": "control", "reason": "TARGETING_MATCH"}
+			]}`,
+		},
+		"bulk missing targeting key": {
+			path:     "/ofrep/v1/evaluate/flags",
+			body:     `{"context": {}}`,
+			status:   http.StatusBadRequest,
+			expected: `{"errorCode": "TARGETING_KEY_MISSING", "errorDetails": "missing target key in evaluation context"}`,
+		},
+		"method not allowed": {
+			method: http.MethodGet,
+			path:   "/ofrep/v1/evaluate/flags/bool-flag",
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			client.SetFaults(tc.faults)
+			method := tc.method
+			if method == "" {
+				method = http.MethodPost
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(method, tc.path, strings.NewReader(tc.body)))
+			assert.Equal(t, tc.status, rec.Code)
+			if tc.expected != "" {
+				assert.JSONEq(t, tc.expected, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestOFREPHandler_ETag(t *testing.T) {
+	client := posthogtest.NewClient(posthogtest.Flag{Key: "bool-flag", Value: true})
+	handler := NewOFREPHandler(NewProvider(client))
+	evaluate := func(etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/ofrep/v1/evaluate/flags", strings.NewReader(`{"context": {"targetingKey": "12345"}}`))
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := evaluate("")
+	require.Equal(t, http.StatusOK, rec.Code)
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	rec = evaluate(etag)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	// Changed flags result in a new ETag.
+	client.SetFlag(posthogtest.Flag{Key: "bool-flag", Value: "variant"})
+	rec = evaluate(etag)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, etag, rec.Header().Get("ETag"))
+
+	var res struct{ Flags []ofrepFlag }
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	assert.Equal(t, "variant", res.Flags[0].Value)
+}
+
+func TestOFREPHandler_BulkFallbacks(t *testing.T) {
+	client := posthogtest.NewClient(posthogtest.Flag{Key: "bool-flag", Value: true})
+	store := NewMemoryFallbackStore(FallbackStoreConfig{})
+	evaluate := func(p *Provider) string {
+		rec := httptest.NewRecorder()
+		NewOFREPHandler(p).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/ofrep/v1/evaluate/flags",
+			strings.NewReader(`{"context": {"targetingKey": "12345"}}`)))
+		require.Equal(t, http.StatusOK, rec.Code)
+		return rec.Body.String()
+	}
+
+	// Results are cached.
+	p := NewProvider(client, WithFallbackStore(store), WithCache(CacheConfig{SoftTTL: time.Minute}))
+	assert.JSONEq(t, `{"flags": [{"key": "bool-flag", "value": true, "reason": "TARGETING_MATCH"}]}`, evaluate(p))
+	client.SetFlag(posthogtest.Flag{Key: "bool-flag", Value: "variant"})
+	assert.JSONEq(t, `{"flags": [{"key": "bool-flag", "value": true, "reason": "CACHED"}]}`, evaluate(p))
+
+	// The last known values are served while PostHog is unreachable.
+	p = NewProvider(unreachableClient{Client: client}, WithFallbackStore(store))
+	assert.JSONEq(t, `{"flags": [{"key": "bool-flag", "value": true, "reason": "STALE"}]}`, evaluate(p))
+
+	// Without last known values, the bootstrap values are served.
+	p = NewProvider(unreachableClient{Client: client}, WithBootstrap(Bootstrap{Flags: map[string]interface{}{"int-flag": 20}}))
+	assert.JSONEq(t, `{"flags": [{"key": "int-flag", "value": "20", "variant": "20", "reason": "STATIC"}]}`, evaluate(p))
+}
+
+func TestOFREPHandler_BulkFailure(t *testing.T) {
+	client := posthogtest.NewClient(posthogtest.Flag{Key: "bool-flag", Value: true})
+	rec := httptest.NewRecorder()
+	NewOFREPHandler(NewProvider(unreachableClient{Client: client})).ServeHTTP(rec, httptest.NewRequest(http.MethodPost,
+		"/ofrep/v1/evaluate/flags", strings.NewReader(`{"context": {"targetingKey": "12345"}}`)))
+
+	// The cause is logged instead of being returned.
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.JSONEq(t, `{"errorCode": "GENERAL", "errorDetails": "evaluation failed"}`, rec.Body.String())
+}
@@ -0,0 +1,233 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/open-feature/go-sdk/openfeature"
+)
+
+var (
+	_ openfeature.FeatureProvider = (*overrideProvider)(nil)
+	_ openfeature.StateHandler    = (*overrideProvider)(nil)
+	_ openfeature.EventHandler    = (*overrideProvider)(nil)
+)
+
+// overrideProvider returns fixed values for the overridden flags and delegates all other flags to the wrapped provider.
+type overrideProvider struct {
+	openfeature.FeatureProvider
+
+	overrides map[string]interface{}
+}
+
+// WithOverrides registers a provider for a domain unique to the test, which returns the given values for the
+// overridden flags and delegates all other flags to the given provider. The returned client is bound to that domain,
+// hence tests using it can safely run in parallel.
+//
+// Override values may either be of the evaluated type or a string, which is parsed the same way as flag values
+// returned by PostHog. The given provider is shared with other tests, so it is neither initialized nor shut down by
+// the override provider, but its state and events are forwarded. Once the test finished, the provider previously bound
+// to the domain, if any, is bound to it again.
+func WithOverrides(t testing.TB, provider openfeature.FeatureProvider, overrides map[string]interface{}) *openfeature.Client {
+	t.Helper()
+
+	domain := t.Name()
+	namedProvidersMu.Lock()
+	defer namedProvidersMu.Unlock()
+
+	previous, bound := namedProvider(domain)
+	if err := openfeature.SetNamedProviderAndWait(domain, newOverrideProvider(provider, overrides)); err != nil {
+		t.Fatalf("setting override provider: %v", err)
+	}
+	t.Cleanup(func() {
+		if !bound {
+			// Providers cannot be unbound from a domain. The override provider stays bound to the domain unique to the
+			// test instead of binding the default provider to it, which would initialize the default provider again.
+			return
+		}
+		namedProvidersMu.Lock()
+		defer namedProvidersMu.Unlock()
+		_ = openfeature.SetNamedProviderAndWait(domain, previous)
+	})
+
+	return openfeature.NewClient(domain)
+}
+
+// namedProvidersMu serializes looking up and binding named providers in WithOverrides, as the API returns its named
+// providers without copying them.
+var namedProvidersMu sync.Mutex
+
+// namedProvider returns the provider bound to the domain and whether there is one.
+func namedProvider(domain string) (openfeature.FeatureProvider, bool) {
+	api, ok := openfeature.GetApiInstance().(interface {
+		GetNamedProviders() map[string]openfeature.FeatureProvider
+	})
+	if !ok {
+		return nil, false
+	}
+	provider, ok := api.GetNamedProviders()[domain]
+	return provider, ok
+}
+
+func newOverrideProvider(provider openfeature.FeatureProvider, overrides map[string]interface{}) *overrideProvider {
+	copied := make(map[string]interface{}, len(overrides))
+	for flag, value := range overrides {
+		copied[flag] = value
+	}
+
+	return &overrideProvider{
+		FeatureProvider: provider,
+		overrides:       copied,
+	}
+}
+
+// Init does not initialize the wrapped provider, which is owned by the caller.
+func (p *overrideProvider) Init(openfeature.EvaluationContext) error {
+	return nil
+}
+
+// Shutdown does not shut down the wrapped provider, which may still be used by other tests.
+func (p *overrideProvider) Shutdown() {}
+
+// Status returns the state of the wrapped provider.
+func (p *overrideProvider) Status() openfeature.State {
+	if handler, ok := p.FeatureProvider.(openfeature.StateHandler); ok {
+		return handler.Status()
+	}
+	return openfeature.ReadyState
+}
+
+// EventChannel returns the event channel of the wrapped provider. Providers without events have a nil channel, which
+// never emits.
+func (p *overrideProvider) EventChannel() <-chan openfeature.Event {
+	if handler, ok := p.FeatureProvider.(openfeature.EventHandler); ok {
+		return handler.EventChannel()
+	}
+	return nil
+}
+
+func (p *overrideProvider) BooleanEvaluation(ctx context.Context, flag string, defaultValue bool, evalCtx openfeature.FlattenedContext) openfeature.BoolResolutionDetail {
+	override, ok := p.overrides[flag]
+	if !ok {
+		return p.FeatureProvider.BooleanEvaluation(ctx, flag, defaultValue, evalCtx)
+	}
+
+	value, detail := resolveOverride(override, defaultValue)
+	return openfeature.BoolResolutionDetail{Value: value, ProviderResolutionDetail: detail}
+}
+
+func (p *overrideProvider) FloatEvaluation(ctx context.Context, flag string, defaultValue float64, evalCtx openfeature.FlattenedContext) openfeature.FloatResolutionDetail {
+	override, ok := p.overrides[flag]
+	if !ok {
+		return p.FeatureProvider.FloatEvaluation(ctx, flag, defaultValue, evalCtx)
+	}
+
+	value, detail := resolveOverride(override, defaultValue)
+	return openfeature.FloatResolutionDetail{Value: value, ProviderResolutionDetail: detail}
+}
+
+func (p *overrideProvider) IntEvaluation(ctx context.Context, flag string, defaultValue int64, evalCtx openfeature.FlattenedContext) openfeature.IntResolutionDetail {
+	override, ok := p.overrides[flag]
+	if !ok {
+		return p.FeatureProvider.IntEvaluation(ctx, flag, defaultValue, evalCtx)
+	}
+
+	value, detail := resolveOverride(override, defaultValue)
+	return openfeature.IntResolutionDetail{Value: value, ProviderResolutionDetail: detail}
+}
+
+func (p *overrideProvider) ObjectEvaluation(ctx context.Context, flag string, defaultValue interface{}, evalCtx openfeature.FlattenedContext) openfeature.InterfaceResolutionDetail {
+	override, ok := p.overrides[flag]
+	if !ok {
+		return p.FeatureProvider.ObjectEvaluation(ctx, flag, defaultValue, evalCtx)
+	}
+
+	return openfeature.InterfaceResolutionDetail{
+		Value: override,
+		ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
+			Reason: openfeature.StaticReason,
+		},
+	}
+}
+
+func (p *overrideProvider) StringEvaluation(ctx context.Context, flag string, defaultValue string, evalCtx openfeature.FlattenedContext) openfeature.StringResolutionDetail {
+	override, ok := p.overrides[flag]
+	if !ok {
+		return p.FeatureProvider.StringEvaluation(ctx, flag, defaultValue, evalCtx)
+	}
+
+	value, detail := resolveOverride(override, defaultValue)
+	return openfeature.StringResolutionDetail{Value: value, ProviderResolutionDetail: detail}
+}
+
+// resolveOverride converts the override to T. On a type mismatch, the default value is returned with the error.
+func resolveOverride[T any](override interface{}, defaultValue T) (T, openfeature.ProviderResolutionDetail) {
+	value, resolutionErr := convertOverride[T](override)
+	if resolutionErr != nil {
+		return defaultValue, openfeature.ProviderResolutionDetail{
+			ResolutionError: *resolutionErr,
+			Reason:          openfeature.ErrorReason,
+		}
+	}
+
+	return value, openfeature.ProviderResolutionDetail{
+		Reason: openfeature.StaticReason,
+	}
+}
+
+func convertOverride[T any](override interface{}) (T, *openfeature.ResolutionError) {
+	if v, ok := override.(T); ok {
+		return v, nil
+	}
+
+	// Numbers decoded from JSON or written as untyped constants do not necessarily match the evaluated type.
+	var converted interface{}
+	switch any(*new(T)).(type) {
+	case int64:
+		switch v := override.(type) {
+		case int:
+			converted = int64(v)
+		case int32:
+			converted = int64(v)
+		case float64:
+			if v == float64(int64(v)) {
+				converted = int64(v)
+			}
+		}
+	case float64:
+		switch v := override.(type) {
+		case int:
+			converted = float64(v)
+		case int64:
+			converted = float64(v)
+		case float32:
+			converted = float64(v)
+		}
+	}
+	if converted != nil {
+		return converted.(T), nil
+	}
+
+	if _, ok := override.(string); ok {
+		return parseFlagValue[T](override)
+	}
+
+	err := openfeature.NewTypeMismatchResolutionError(fmt.Sprintf("override %v is not a %T", override, *new(T)))
+	return *new(T), &err
+}
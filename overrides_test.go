@@ -0,0 +1,178 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithOverrides(t *testing.T) {
+	p := NewProvider(posthogtest.NewClient(
+		posthogtest.Flag{Key: "bool-flag", Value: true},
+		posthogtest.Flag{Key: "string-flag", Value: "posthog"},
+	))
+	evalCtx := openfeature.NewEvaluationContext("12345", nil)
+
+	t.Run("overridden", func(t *testing.T) {
+		t.Parallel()
+		c := WithOverrides(t, p, map[string]interface{}{
+			"bool-flag":   false,
+			"string-flag": "override",
+			"int-flag":    42,
+			"float-flag":  "0.5",
+			"object-flag": map[string]interface{}{"name": "jane doe"},
+		})
+
+		b, err := c.BooleanValueDetails(context.Background(), "bool-flag", true, evalCtx)
+		require.NoError(t, err)
+		assert.False(t, b.Value)
+		assert.Equal(t, openfeature.StaticReason, b.Reason)
+
+		s, err := c.StringValue(context.Background(), "string-flag", "default", evalCtx)
+		require.NoError(t, err)
+		assert.Equal(t, "override", s)
+
+		i, err := c.IntValue(context.Background(), "int-flag", 0, evalCtx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(42), i)
+
+		f, err := c.FloatValue(context.Background(), "float-flag", 0, evalCtx)
+		require.NoError(t, err)
+		assert.Equal(t, 0.5, f)
+
+		o, err := c.ObjectValue(context.Background(), "object-flag", nil, evalCtx)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"name": "jane doe"}, o)
+	})
+
+	t.Run("delegated", func(t *testing.T) {
+		t.Parallel()
+		c := WithOverrides(t, p, map[string]interface{}{"bool-flag": false})
+
+		s, err := c.StringValueDetails(context.Background(), "string-flag", "default", evalCtx)
+		require.NoError(t, err)
+		assert.Equal(t, "posthog", s.Value)
+		assert.Equal(t, openfeature.TargetingMatchReason, s.Reason)
+	})
+
+	t.Run("type mismatch", func(t *testing.T) {
+		t.Parallel()
+		c := WithOverrides(t, p, map[string]interface{}{"int-flag": "not a number"})
+
+		i, err := c.IntValueDetails(context.Background(), "int-flag", 10, evalCtx)
+		require.Error(t, err)
+		assert.Equal(t, int64(10), i.Value)
+		assert.Equal(t, openfeature.TypeMismatchCode, i.ErrorCode)
+	})
+}
+
+func TestWithOverrides_RestoresPreviousProvider(t *testing.T) {
+	p := NewProvider(posthogtest.NewClient(posthogtest.Flag{Key: "string-flag", Value: "posthog"}))
+	evalCtx := openfeature.NewEvaluationContext("12345", nil)
+
+	var domain string
+	t.Run("overridden", func(t *testing.T) {
+		domain = t.Name()
+		require.NoError(t, openfeature.SetNamedProviderAndWait(domain, NewStaticProvider(map[string]interface{}{"string-flag": "previous"})))
+
+		c := WithOverrides(t, p, map[string]interface{}{"string-flag": "override"})
+		s, err := c.StringValue(context.Background(), "string-flag", "default", evalCtx)
+		require.NoError(t, err)
+		assert.Equal(t, "override", s)
+	})
+	t.Cleanup(func() {
+		_ = openfeature.SetNamedProviderAndWait(domain, openfeature.NoopProvider{})
+	})
+
+	s, err := openfeature.NewClient(domain).StringValue(context.Background(), "string-flag", "default", evalCtx)
+	require.NoError(t, err)
+	assert.Equal(t, "previous", s)
+}
+
+func TestWithOverrides_KeepsDefaultProviderUnbound(t *testing.T) {
+	var domain string
+	t.Run("overridden", func(t *testing.T) {
+		domain = t.Name()
+		WithOverrides(t, NewStaticProvider(map[string]interface{}{"string-flag": "wrapped"}), nil)
+	})
+
+	// The default provider is not bound to the domain of the test.
+	provider, ok := namedProvider(domain)
+	require.True(t, ok)
+	assert.IsType(t, &overrideProvider{}, provider)
+}
+
+// statefulProvider records the calls of the state and event handlers.
+type statefulProvider struct {
+	openfeature.NoopProvider
+
+	events    chan openfeature.Event
+	inits     atomic.Int32
+	shutdowns atomic.Int32
+}
+
+func (p *statefulProvider) Init(openfeature.EvaluationContext) error {
+	p.inits.Add(1)
+	return nil
+}
+
+func (p *statefulProvider) Shutdown() {
+	p.shutdowns.Add(1)
+}
+
+func (p *statefulProvider) Status() openfeature.State {
+	return openfeature.StaleState
+}
+
+func (p *statefulProvider) EventChannel() <-chan openfeature.Event {
+	return p.events
+}
+
+func TestWithOverrides_ForwardsStateAndEvents(t *testing.T) {
+	provider := &statefulProvider{events: make(chan openfeature.Event, 1)}
+
+	t.Run("overridden", func(t *testing.T) {
+		c := WithOverrides(t, provider, nil)
+
+		stale := make(chan struct{}, 1)
+		callback := func(openfeature.EventDetails) {
+			stale <- struct{}{}
+		}
+		c.AddHandler(openfeature.ProviderStale, &callback)
+		provider.events <- openfeature.Event{ProviderName: "stateful", EventType: openfeature.ProviderStale}
+		select {
+		case <-stale:
+		case <-time.After(time.Second):
+			t.Fatal("event of the wrapped provider was not forwarded")
+		}
+	})
+
+	// The wrapped provider is owned by the caller.
+	assert.Equal(t, int32(0), provider.inits.Load())
+	assert.Equal(t, int32(0), provider.shutdowns.Load())
+
+	overrides := newOverrideProvider(provider, nil)
+	assert.Equal(t, openfeature.StaleState, overrides.Status())
+	assert.Equal(t, (<-chan openfeature.Event)(provider.events), overrides.EventChannel())
+	assert.Nil(t, newOverrideProvider(openfeature.NoopProvider{}, nil).EventChannel())
+}
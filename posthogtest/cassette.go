@@ -0,0 +1,296 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package posthogtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/posthog/posthog-go"
+)
+
+// Methods of posthog.Client which are recorded in a cassette.
+const (
+	MethodGetFeatureFlag        = "GetFeatureFlag"
+	MethodGetFeatureFlagPayload = "GetFeatureFlagPayload"
+)
+
+var (
+	_ posthog.Client = (*Recorder)(nil)
+	_ posthog.Client = (*Replayer)(nil)
+
+	// ErrUnexpectedRequest is returned by the Replayer for requests which are not part of the cassette.
+	ErrUnexpectedRequest = errors.New("unexpected request")
+
+	errNotReplayed = errors.New("not supported by the replayer")
+)
+
+// Interaction is a single request and its response, stored as one line of a JSONL cassette.
+type Interaction struct {
+	Method   string      `json:"method"`
+	Request  Request     `json:"request"`
+	Response interface{} `json:"response"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// Request is the recorded part of a posthog.FeatureFlagPayload.
+type Request struct {
+	Key              string                        `json:"key"`
+	DistinctID       string                        `json:"distinct_id"`
+	Groups           posthog.Groups                `json:"groups,omitempty"`
+	PersonProperties posthog.Properties            `json:"person_properties,omitempty"`
+	GroupProperties  map[string]posthog.Properties `json:"group_properties,omitempty"`
+}
+
+func newRequest(payload posthog.FeatureFlagPayload) Request {
+	return Request{
+		Key:              payload.Key,
+		DistinctID:       payload.DistinctId,
+		Groups:           payload.Groups,
+		PersonProperties: payload.PersonProperties,
+		GroupProperties:  payload.GroupProperties,
+	}
+}
+
+// Recorder wraps a posthog.Client and writes every GetFeatureFlag and GetFeatureFlagPayload request together with
+// its response to a JSONL cassette. All other methods are passed through.
+type Recorder struct {
+	posthog.Client
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewRecorder creates a new recorder for the client writing the cassette to w.
+func NewRecorder(client posthog.Client, w io.Writer) *Recorder {
+	return &Recorder{
+		Client: client,
+		enc:    json.NewEncoder(w),
+	}
+}
+
+// GetFeatureFlag calls the wrapped client and records the interaction.
+func (r *Recorder) GetFeatureFlag(payload posthog.FeatureFlagPayload) (interface{}, error) {
+	res, err := r.Client.GetFeatureFlag(payload)
+	r.record(MethodGetFeatureFlag, payload, res, err)
+	return res, err
+}
+
+// GetFeatureFlagPayload calls the wrapped client and records the interaction.
+func (r *Recorder) GetFeatureFlagPayload(payload posthog.FeatureFlagPayload) (string, error) {
+	res, err := r.Client.GetFeatureFlagPayload(payload)
+	r.record(MethodGetFeatureFlagPayload, payload, res, err)
+	return res, err
+}
+
+// Err returns the first error which occurred while writing the cassette.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) record(method string, payload posthog.FeatureFlagPayload, res interface{}, err error) {
+	interaction := Interaction{
+		Method:   method,
+		Request:  newRequest(payload),
+		Response: res,
+	}
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if encodeErr := r.enc.Encode(interaction); encodeErr != nil && r.err == nil {
+		r.err = encodeErr
+	}
+}
+
+// Replayer is a posthog.Client serving the responses of a cassette. Requests are matched by method and payload,
+// requests not part of the cassette fail with ErrUnexpectedRequest.
+// Captured events are discarded.
+type Replayer struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	requests     [][]byte
+	used         []bool
+}
+
+// NewReplayer creates a new replayer reading the JSONL cassette from r.
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	replayer := &Replayer{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var interaction Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &interaction); err != nil {
+			return nil, fmt.Errorf("parsing cassette line %d: %w", line, err)
+		}
+		request, err := json.Marshal(interaction.Request)
+		if err != nil {
+			return nil, fmt.Errorf("parsing cassette line %d: %w", line, err)
+		}
+
+		replayer.interactions = append(replayer.interactions, interaction)
+		replayer.requests = append(replayer.requests, request)
+		replayer.used = append(replayer.used, false)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return replayer, nil
+}
+
+// LoadCassette creates a new replayer reading the JSONL cassette from the file at path.
+func LoadCassette(path string) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return NewReplayer(f)
+}
+
+// Unused returns the interactions of the cassette which have not been replayed yet.
+func (r *Replayer) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var unused []Interaction
+	for i, interaction := range r.interactions {
+		if !r.used[i] {
+			unused = append(unused, interaction)
+		}
+	}
+	return unused
+}
+
+// GetFeatureFlag replays the recorded response for the payload.
+func (r *Replayer) GetFeatureFlag(payload posthog.FeatureFlagPayload) (interface{}, error) {
+	interaction, err := r.replay(MethodGetFeatureFlag, payload)
+	if err != nil {
+		return false, err
+	}
+	if interaction.Error != "" {
+		return interaction.Response, errors.New(interaction.Error)
+	}
+	return interaction.Response, nil
+}
+
+// GetFeatureFlagPayload replays the recorded response for the payload.
+func (r *Replayer) GetFeatureFlagPayload(payload posthog.FeatureFlagPayload) (string, error) {
+	interaction, err := r.replay(MethodGetFeatureFlagPayload, payload)
+	if err != nil {
+		return "", err
+	}
+
+	res, _ := interaction.Response.(string)
+	if interaction.Error != "" {
+		return res, errors.New(interaction.Error)
+	}
+	return res, nil
+}
+
+// IsFeatureEnabled replays the recorded GetFeatureFlag response for the payload, converting "true" and "false"
+// variants to booleans.
+func (r *Replayer) IsFeatureEnabled(payload posthog.FeatureFlagPayload) (interface{}, error) {
+	res, err := r.GetFeatureFlag(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	switch res {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return res, nil
+	}
+}
+
+// Enqueue discards the message.
+func (r *Replayer) Enqueue(posthog.Message) error {
+	return nil
+}
+
+// Close is a no-op.
+func (r *Replayer) Close() error {
+	return nil
+}
+
+// GetAllFlags is not recorded and always returns an error.
+func (r *Replayer) GetAllFlags(posthog.FeatureFlagPayloadNoKey) (map[string]interface{}, error) {
+	return nil, fmt.Errorf("GetAllFlags: %w", errNotReplayed)
+}
+
+// ReloadFeatureFlags is a no-op.
+func (r *Replayer) ReloadFeatureFlags() error {
+	return nil
+}
+
+// GetFeatureFlags is not recorded and always returns an error.
+func (r *Replayer) GetFeatureFlags() ([]posthog.FeatureFlag, error) {
+	return nil, fmt.Errorf("GetFeatureFlags: %w", errNotReplayed)
+}
+
+// GetLastCapturedEvent always returns nil, since captured events are discarded.
+func (r *Replayer) GetLastCapturedEvent() *posthog.Capture {
+	return nil
+}
+
+// replay returns the first unused interaction matching the request. Once all matching interactions have been used,
+// the last one is replayed again.
+func (r *Replayer) replay(method string, payload posthog.FeatureFlagPayload) (Interaction, error) {
+	request, err := json.Marshal(newRequest(payload))
+	if err != nil {
+		return Interaction{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	match := -1
+	for i, interaction := range r.interactions {
+		if interaction.Method != method || !bytes.Equal(r.requests[i], request) {
+			continue
+		}
+		match = i
+		if !r.used[i] {
+			break
+		}
+	}
+	if match < 0 {
+		return Interaction{}, fmt.Errorf("%w: %s %s", ErrUnexpectedRequest, method, request)
+	}
+
+	r.used[match] = true
+	return r.interactions[match], nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package posthogtest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/posthog/posthog-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorderReplayer(t *testing.T) {
+	client := NewClient(Flag{
+		Key:     "variant-flag",
+		Value:   "control",
+		Payload: `{"color": "blue"}`,
+		Rules:   []Rule{{PersonProperties: posthog.Properties{"size": 50}, Value: "large"}},
+	})
+
+	var cassette bytes.Buffer
+	recorder := NewRecorder(client, &cassette)
+
+	payload := posthog.FeatureFlagPayload{
+		Key:              "variant-flag",
+		DistinctId:       "12345",
+		PersonProperties: posthog.Properties{"size": 50},
+	}
+	res, err := recorder.GetFeatureFlag(payload)
+	require.NoError(t, err)
+	assert.Equal(t, "large", res)
+	flagPayload, err := recorder.GetFeatureFlagPayload(posthog.FeatureFlagPayload{Key: "variant-flag", DistinctId: "12345"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"color": "blue"}`, flagPayload)
+	require.NoError(t, recorder.Err())
+
+	// The wrapped client still captures its events.
+	assert.Len(t, client.Captures(FeatureFlagCalledEvent), 1)
+
+	replayer, err := NewReplayer(&cassette)
+	require.NoError(t, err)
+	assert.Len(t, replayer.Unused(), 2)
+
+	res, err = replayer.GetFeatureFlag(payload)
+	require.NoError(t, err)
+	assert.Equal(t, "large", res)
+	flagPayload, err = replayer.GetFeatureFlagPayload(posthog.FeatureFlagPayload{Key: "variant-flag", DistinctId: "12345"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"color": "blue"}`, flagPayload)
+	assert.Empty(t, replayer.Unused())
+
+	// Matching interactions can be replayed more than once.
+	res, err = replayer.GetFeatureFlag(payload)
+	require.NoError(t, err)
+	assert.Equal(t, "large", res)
+
+	_, err = replayer.GetFeatureFlag(posthog.FeatureFlagPayload{Key: "variant-flag", DistinctId: "67890"})
+	assert.ErrorIs(t, err, ErrUnexpectedRequest)
+}
+
+func TestReplayer_RecordedError(t *testing.T) {
+	replayer, err := NewReplayer(strings.NewReader(
+		`{"method":"GetFeatureFlag","request":{"key":"flag","distinct_id":"12345"},"response":null,"error":"unexpected status code from /decide/: 500"}`,
+	))
+	require.NoError(t, err)
+
+	_, err = replayer.GetFeatureFlag(posthog.FeatureFlagPayload{Key: "flag", DistinctId: "12345"})
+	assert.EqualError(t, err, "unexpected status code from /decide/: 500")
+}
+
+func TestReplayer_InvalidCassette(t *testing.T) {
+	_, err := NewReplayer(strings.NewReader("{invalid json"))
+	assert.Error(t, err)
+}
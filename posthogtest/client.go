@@ -0,0 +1,424 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package posthogtest provides test doubles for the PostHog Go SDK.
+package posthogtest
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/posthog/posthog-go"
+)
+
+// FeatureFlagCalledEvent is the name of the event the PostHog client captures whenever a flag is evaluated.
+const FeatureFlagCalledEvent = "$feature_flag_called"
+
+var _ posthog.Client = (*Client)(nil)
+
+// Flag is a feature flag served by the fake client.
+type Flag struct {
+	// Key of the flag.
+	Key string `json:"key"`
+	// Value returned when none of the rules match. A nil value is returned as false, which is also what PostHog
+	// returns for disabled or unknown flags.
+	Value interface{} `json:"value"`
+	// Payload returned alongside Value.
+	Payload string `json:"payload"`
+	// Rules are evaluated in order, the first matching rule wins.
+	Rules []Rule `json:"rules"`
+}
+
+// Rule targets a value to the subjects that match all of its conditions. Empty conditions match every subject.
+type Rule struct {
+	// DistinctIDs the rule applies to.
+	DistinctIDs []string `json:"distinct_ids"`
+	// Groups which must all be present with the given key.
+	Groups posthog.Groups `json:"groups"`
+	// PersonProperties which must all be present with the given value.
+	PersonProperties posthog.Properties `json:"person_properties"`
+	// GroupProperties which must all be present for the group type with the given value.
+	GroupProperties map[string]posthog.Properties `json:"group_properties"`
+	// Value returned when the rule matches.
+	Value interface{} `json:"value"`
+	// Payload returned when the rule matches.
+	Payload string `json:"payload"`
+}
+
+// Client is an in-memory implementation of posthog.Client.
+// Flags are evaluated locally against their rules and every enqueued message is recorded.
+// It is safe for concurrent use.
+type Client struct {
+	mu sync.RWMutex
+
+	flags        map[string]Flag
+	events       []posthog.Message
+	lastCaptured *posthog.Capture
+	reported     map[string]struct{}
+	closed       bool
+}
+
+// NewClient creates a new fake client serving the given flags.
+func NewClient(flags ...Flag) *Client {
+	c := &Client{
+		flags:    make(map[string]Flag, len(flags)),
+		reported: make(map[string]struct{}),
+	}
+	for _, flag := range flags {
+		c.flags[flag.Key] = flag
+	}
+	return c
+}
+
+// SetFlag adds the flag or replaces an existing flag with the same key.
+func (c *Client) SetFlag(flag Flag) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flags[flag.Key] = flag
+}
+
+// DeleteFlag removes the flag with the given key.
+func (c *Client) DeleteFlag(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.flags, key)
+}
+
+// Events returns all messages enqueued so far, including the captured $feature_flag_called events.
+func (c *Client) Events() []posthog.Message {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]posthog.Message(nil), c.events...)
+}
+
+// Captures returns all enqueued capture events with the given event name. An empty name returns all captures.
+func (c *Client) Captures(event string) []posthog.Capture {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var captures []posthog.Capture
+	for _, msg := range c.events {
+		capture, ok := msg.(posthog.Capture)
+		if !ok {
+			continue
+		}
+		if event == "" || capture.Event == event {
+			captures = append(captures, capture)
+		}
+	}
+	return captures
+}
+
+// Reset drops all recorded events. Flags are kept.
+func (c *Client) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = nil
+	c.lastCaptured = nil
+	c.reported = make(map[string]struct{})
+}
+
+// Close marks the client as closed. Subsequent calls to Close or Enqueue return posthog.ErrClosed.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return posthog.ErrClosed
+	}
+	c.closed = true
+	return nil
+}
+
+// Enqueue records the message.
+func (c *Client) Enqueue(msg posthog.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enqueue(msg)
+}
+
+func (c *Client) enqueue(msg posthog.Message) error {
+	if c.closed {
+		return posthog.ErrClosed
+	}
+
+	msg = dereferenceMessage(msg)
+	if msg == nil {
+		return fmt.Errorf("nil messages cannot be enqueued")
+	}
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+
+	if capture, ok := msg.(posthog.Capture); ok {
+		c.lastCaptured = &capture
+	}
+	c.events = append(c.events, msg)
+	return nil
+}
+
+// IsFeatureEnabled returns the flag value, converting "true" and "false" variants to booleans.
+func (c *Client) IsFeatureEnabled(payload posthog.FeatureFlagPayload) (interface{}, error) {
+	res, err := c.GetFeatureFlag(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	switch res {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return res, nil
+	}
+}
+
+// GetFeatureFlag evaluates the flag for the payload and captures a $feature_flag_called event once per flag and
+// distinct ID, unless disabled via SendFeatureFlagEvents.
+func (c *Client) GetFeatureFlag(payload posthog.FeatureFlagPayload) (interface{}, error) {
+	if err := validatePayload(payload.Key, payload.DistinctId); err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, _ := c.evaluate(payload.Key, payload.DistinctId, payload.Groups, payload.PersonProperties, payload.GroupProperties)
+
+	reportKey := payload.DistinctId + "\x00" + payload.Key
+	_, reported := c.reported[reportKey]
+	if (payload.SendFeatureFlagEvents == nil || *payload.SendFeatureFlagEvents) && !reported {
+		_ = c.enqueue(posthog.Capture{
+			DistinctId: payload.DistinctId,
+			Event:      FeatureFlagCalledEvent,
+			Properties: posthog.NewProperties().
+				Set("$feature_flag", payload.Key).
+				Set("$feature_flag_response", value).
+				Set("$feature_flag_errored", false),
+			Groups: payload.Groups,
+		})
+		c.reported[reportKey] = struct{}{}
+	}
+
+	return value, nil
+}
+
+// GetFeatureFlagPayload returns the payload of the flag for the payload, or an empty string if there is none.
+func (c *Client) GetFeatureFlagPayload(payload posthog.FeatureFlagPayload) (string, error) {
+	if err := validatePayload(payload.Key, payload.DistinctId); err != nil {
+		return "", err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	_, flagPayload := c.evaluate(payload.Key, payload.DistinctId, payload.Groups, payload.PersonProperties, payload.GroupProperties)
+	return flagPayload, nil
+}
+
+// GetRemoteConfigPayload returns the payload of the flag independent of any targeting, like the remote config
+// payloads of newer versions of the PostHog client.
+func (c *Client) GetRemoteConfigPayload(flagKey string) (string, error) {
+	if flagKey == "" {
+		return "", posthog.ConfigError{Reason: "Feature Flag Key required", Field: "Key", Value: flagKey}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	flag, ok := c.flags[flagKey]
+	if !ok {
+		return "", fmt.Errorf("remote config %q not found", flagKey)
+	}
+	return flag.Payload, nil
+}
+
+// GetAllFlags evaluates all flags for the payload.
+func (c *Client) GetAllFlags(payload posthog.FeatureFlagPayloadNoKey) (map[string]interface{}, error) {
+	if err := validatePayload("-", payload.DistinctId); err != nil {
+		return nil, err
+	}
+
+	flags, _ := c.evaluateAll(payload.DistinctId, payload.Groups, payload.PersonProperties, payload.GroupProperties)
+	return flags, nil
+}
+
+// ReloadFeatureFlags is a no-op, the fake client always serves its current flags.
+func (c *Client) ReloadFeatureFlags() error {
+	return nil
+}
+
+// GetFeatureFlags returns a minimal definition for every known flag, sorted by key. Definitions hold the payloads of
+// the values of the flag, but no targeting.
+func (c *Client) GetFeatureFlags() ([]posthog.FeatureFlag, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	flags := make([]posthog.FeatureFlag, 0, len(c.flags))
+	for key, flag := range c.flags {
+		flags = append(flags, posthog.FeatureFlag{
+			Key:     key,
+			Active:  true,
+			Filters: posthog.Filter{Payloads: flagPayloads(flag)},
+		})
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Key < flags[j].Key })
+	return flags, nil
+}
+
+// GetLastCapturedEvent returns a copy of the last enqueued capture event, or nil if there is none.
+func (c *Client) GetLastCapturedEvent() *posthog.Capture {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.lastCaptured == nil {
+		return nil
+	}
+	capture := *c.lastCaptured
+	return &capture
+}
+
+func (c *Client) evaluate(key, distinctID string, groups posthog.Groups, personProperties posthog.Properties,
+	groupProperties map[string]posthog.Properties) (interface{}, string) {
+	flag, ok := c.flags[key]
+	if !ok {
+		return false, ""
+	}
+
+	for _, rule := range flag.Rules {
+		if rule.matches(distinctID, groups, personProperties, groupProperties) {
+			return valueOrFalse(rule.Value), rule.Payload
+		}
+	}
+	return valueOrFalse(flag.Value), flag.Payload
+}
+
+func (c *Client) evaluateAll(distinctID string, groups posthog.Groups, personProperties posthog.Properties,
+	groupProperties map[string]posthog.Properties) (map[string]interface{}, map[string]string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	values := make(map[string]interface{}, len(c.flags))
+	payloads := make(map[string]string)
+	for key := range c.flags {
+		value, payload := c.evaluate(key, distinctID, groups, personProperties, groupProperties)
+		values[key] = value
+		if payload != "" {
+			payloads[key] = payload
+		}
+	}
+	return values, payloads
+}
+
+func (r Rule) matches(distinctID string, groups posthog.Groups, personProperties posthog.Properties,
+	groupProperties map[string]posthog.Properties) bool {
+	if len(r.DistinctIDs) > 0 && !contains(r.DistinctIDs, distinctID) {
+		return false
+	}
+	if !containsAll(map[string]interface{}(groups), map[string]interface{}(r.Groups)) {
+		return false
+	}
+	if !containsAll(personProperties, r.PersonProperties) {
+		return false
+	}
+	for groupType, props := range r.GroupProperties {
+		if !containsAll(groupProperties[groupType], props) {
+			return false
+		}
+	}
+	return true
+}
+
+func validatePayload(key, distinctID string) error {
+	if key == "" {
+		return posthog.ConfigError{Reason: "Feature Flag Key required", Field: "Key", Value: key}
+	}
+	if distinctID == "" {
+		return posthog.ConfigError{Reason: "DistinctId required", Field: "Distinct Id", Value: distinctID}
+	}
+	return nil
+}
+
+// flagPayloads returns the payloads of the flag by value, or nil if there are none.
+func flagPayloads(flag Flag) map[string]string {
+	var payloads map[string]string
+	add := func(value interface{}, payload string) {
+		if payload == "" || payloads[fmt.Sprint(value)] != "" {
+			return
+		}
+		if payloads == nil {
+			payloads = make(map[string]string)
+		}
+		payloads[fmt.Sprint(value)] = payload
+	}
+
+	for _, rule := range flag.Rules {
+		add(rule.Value, rule.Payload)
+	}
+	add(flag.Value, flag.Payload)
+	return payloads
+}
+
+func valueOrFalse(v interface{}) interface{} {
+	if v == nil {
+		return false
+	}
+	return v
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAll(actual, expected map[string]interface{}) bool {
+	for key, value := range expected {
+		actualValue, ok := actual[key]
+		if !ok || !reflect.DeepEqual(actualValue, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func dereferenceMessage(msg posthog.Message) posthog.Message {
+	switch m := msg.(type) {
+	case *posthog.Alias:
+		if m == nil {
+			return nil
+		}
+		return *m
+	case *posthog.Identify:
+		if m == nil {
+			return nil
+		}
+		return *m
+	case *posthog.GroupIdentify:
+		if m == nil {
+			return nil
+		}
+		return *m
+	case *posthog.Capture:
+		if m == nil {
+			return nil
+		}
+		return *m
+	}
+	return msg
+}
@@ -0,0 +1,193 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package posthogtest
+
+import (
+	"testing"
+
+	"github.com/posthog/posthog-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_GetFeatureFlag(t *testing.T) {
+	c := NewClient(
+		Flag{
+			Key:   "variant-flag",
+			Value: "control",
+			Rules: []Rule{
+				{DistinctIDs: []string{"beta-user"}, Value: "beta"},
+				{Groups: posthog.Groups{"company": "acme"}, Value: "acme"},
+				{PersonProperties: posthog.Properties{"plan": "pro"}, Value: "pro"},
+				{
+					GroupProperties: map[string]posthog.Properties{"company": {"size": 50}},
+					Value:           "large",
+				},
+			},
+		},
+		Flag{Key: "disabled-flag"},
+	)
+
+	tcs := map[string]struct {
+		payload posthog.FeatureFlagPayload
+		res     interface{}
+	}{
+		"no rule matches": {
+			payload: posthog.FeatureFlagPayload{Key: "variant-flag", DistinctId: "12345"},
+			res:     "control",
+		},
+		"distinct id rule": {
+			payload: posthog.FeatureFlagPayload{Key: "variant-flag", DistinctId: "beta-user"},
+			res:     "beta",
+		},
+		"group rule": {
+			payload: posthog.FeatureFlagPayload{
+				Key:        "variant-flag",
+				DistinctId: "12345",
+				Groups:     posthog.Groups{"company": "acme"},
+			},
+			res: "acme",
+		},
+		"person property rule": {
+			payload: posthog.FeatureFlagPayload{
+				Key:              "variant-flag",
+				DistinctId:       "12345",
+				PersonProperties: posthog.Properties{"plan": "pro", "country": "DE"},
+			},
+			res: "pro",
+		},
+		"group property rule": {
+			payload: posthog.FeatureFlagPayload{
+				Key:             "variant-flag",
+				DistinctId:      "12345",
+				GroupProperties: map[string]posthog.Properties{"company": {"size": 50}},
+			},
+			res: "large",
+		},
+		"disabled flag": {
+			payload: posthog.FeatureFlagPayload{Key: "disabled-flag", DistinctId: "12345"},
+			res:     false,
+		},
+		"unknown flag": {
+			payload: posthog.FeatureFlagPayload{Key: "unknown-flag", DistinctId: "12345"},
+			res:     false,
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			res, err := c.GetFeatureFlag(tc.payload)
+			require.NoError(t, err)
+			assert.Equal(t, tc.res, res)
+		})
+	}
+}
+
+func TestClient_GetFeatureFlag_MissingDistinctID(t *testing.T) {
+	c := NewClient(Flag{Key: "flag", Value: true})
+
+	_, err := c.GetFeatureFlag(posthog.FeatureFlagPayload{Key: "flag"})
+	assert.Error(t, err)
+	assert.Empty(t, c.Events())
+}
+
+func TestClient_FeatureFlagCalledEvents(t *testing.T) {
+	c := NewClient(Flag{Key: "flag", Value: true})
+
+	for i := 0; i < 2; i++ {
+		_, err := c.GetFeatureFlag(posthog.FeatureFlagPayload{Key: "flag", DistinctId: "12345"})
+		require.NoError(t, err)
+	}
+	disabled := false
+	_, err := c.GetFeatureFlag(posthog.FeatureFlagPayload{Key: "flag", DistinctId: "67890", SendFeatureFlagEvents: &disabled})
+	require.NoError(t, err)
+
+	calls := c.Captures(FeatureFlagCalledEvent)
+	require.Len(t, calls, 1)
+	assert.Equal(t, "12345", calls[0].DistinctId)
+	assert.Equal(t, "flag", calls[0].Properties["$feature_flag"])
+	assert.Equal(t, true, calls[0].Properties["$feature_flag_response"])
+
+	c.Reset()
+	assert.Empty(t, c.Events())
+}
+
+func TestClient_GetFeatureFlagPayload(t *testing.T) {
+	c := NewClient(Flag{
+		Key:     "flag",
+		Value:   "control",
+		Payload: `{"color": "blue"}`,
+		Rules:   []Rule{{DistinctIDs: []string{"beta-user"}, Value: "beta", Payload: `{"color": "red"}`}},
+	})
+
+	payload, err := c.GetFeatureFlagPayload(posthog.FeatureFlagPayload{Key: "flag", DistinctId: "12345"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"color": "blue"}`, payload)
+
+	payload, err = c.GetFeatureFlagPayload(posthog.FeatureFlagPayload{Key: "flag", DistinctId: "beta-user"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"color": "red"}`, payload)
+}
+
+func TestClient_GetRemoteConfigPayload(t *testing.T) {
+	c := NewClient(Flag{Key: "config", Payload: `{"timeout": 5}`})
+
+	payload, err := c.GetRemoteConfigPayload("config")
+	require.NoError(t, err)
+	assert.Equal(t, `{"timeout": 5}`, payload)
+
+	_, err = c.GetRemoteConfigPayload("unknown")
+	assert.Error(t, err)
+}
+
+func TestClient_GetAllFlags(t *testing.T) {
+	c := NewClient(
+		Flag{Key: "bool-flag", Value: true},
+		Flag{Key: "variant-flag", Value: "control", Rules: []Rule{{DistinctIDs: []string{"beta-user"}, Value: "beta"}}},
+		Flag{Key: "disabled-flag"},
+	)
+
+	flags, err := c.GetAllFlags(posthog.FeatureFlagPayloadNoKey{DistinctId: "beta-user"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"bool-flag":     true,
+		"variant-flag":  "beta",
+		"disabled-flag": false,
+	}, flags)
+}
+
+func TestClient_IsFeatureEnabled(t *testing.T) {
+	c := NewClient(Flag{Key: "flag", Value: "true"})
+
+	res, err := c.IsFeatureEnabled(posthog.FeatureFlagPayload{Key: "flag", DistinctId: "12345"})
+	require.NoError(t, err)
+	assert.Equal(t, true, res)
+}
+
+func TestClient_Enqueue(t *testing.T) {
+	c := NewClient()
+
+	require.NoError(t, c.Enqueue(posthog.Capture{DistinctId: "12345", Event: "signed-up"}))
+	require.NoError(t, c.Enqueue(&posthog.Identify{DistinctId: "12345"}))
+	assert.Error(t, c.Enqueue(posthog.Capture{DistinctId: "12345"}))
+
+	assert.Len(t, c.Events(), 2)
+	require.NotNil(t, c.GetLastCapturedEvent())
+	assert.Equal(t, "signed-up", c.GetLastCapturedEvent().Event)
+
+	require.NoError(t, c.Close())
+	assert.ErrorIs(t, c.Close(), posthog.ErrClosed)
+	assert.ErrorIs(t, c.Enqueue(posthog.Capture{DistinctId: "12345", Event: "signed-up"}), posthog.ErrClosed)
+}
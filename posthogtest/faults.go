@@ -0,0 +1,140 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package posthogtest
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/posthog/posthog-go"
+)
+
+var (
+	_ posthog.Client = (*FaultyClient)(nil)
+
+	// ErrInjected is the error returned by a FaultyClient unless another error is configured.
+	ErrInjected = errors.New("injected fault")
+
+	// DefaultMalformedValues are returned by a FaultyClient unless other malformed values are configured.
+	DefaultMalformedValues = []interface{}{42, 0.5, []interface{}{"a"}, map[string]interface{}{"a": 1}, "{invalid json"}
+)
+
+// Faults configures the faults a FaultyClient injects. Rates are probabilities between 0 and 1 and are applied in
+// the order panic, error, malformed value.
+type Faults struct {
+	// Latency added to every call.
+	Latency time.Duration
+	// LatencyJitter adds a random latency between 0 and LatencyJitter on top of Latency.
+	LatencyJitter time.Duration
+	// ErrorRate is the probability of returning Err instead of calling the wrapped client.
+	ErrorRate float64
+	// Err is the error returned for injected errors. Defaults to ErrInjected.
+	Err error
+	// PanicRate is the probability of panicking instead of calling the wrapped client.
+	PanicRate float64
+	// MalformedRate is the probability of replacing the response with one of MalformedValues.
+	MalformedRate float64
+	// MalformedValues returned for injected malformed responses. Defaults to DefaultMalformedValues.
+	MalformedValues []interface{}
+	// Seed for the random number generator, making the injected faults reproducible.
+	Seed int64
+}
+
+// FaultyClient wraps a posthog.Client and injects faults into the GetFeatureFlag responses. All other methods are
+// passed through.
+type FaultyClient struct {
+	posthog.Client
+
+	mu     sync.Mutex
+	faults Faults
+	rand   *rand.Rand
+}
+
+// NewFaultyClient creates a new client injecting the faults into the responses of client.
+func NewFaultyClient(client posthog.Client, faults Faults) *FaultyClient {
+	c := &FaultyClient{Client: client}
+	c.SetFaults(faults)
+	return c
+}
+
+// SetFaults replaces the injected faults, e.g. to simulate recovery of PostHog.
+func (c *FaultyClient) SetFaults(faults Faults) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.faults = faults
+	c.rand = rand.New(rand.NewSource(faults.Seed))
+}
+
+// GetFeatureFlag calls the wrapped client, injecting the configured faults.
+func (c *FaultyClient) GetFeatureFlag(payload posthog.FeatureFlagPayload) (interface{}, error) {
+	f := c.roll()
+
+	if f.latency > 0 {
+		time.Sleep(f.latency)
+	}
+	if f.panics {
+		panic(ErrInjected)
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	res, err := c.Client.GetFeatureFlag(payload)
+	if err != nil {
+		return res, err
+	}
+	if f.malformed != nil {
+		return f.malformed, nil
+	}
+	return res, nil
+}
+
+// fault is the set of faults injected into a single call.
+type fault struct {
+	latency   time.Duration
+	panics    bool
+	err       error
+	malformed interface{}
+}
+
+func (c *FaultyClient) roll() fault {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f := fault{latency: c.faults.Latency}
+	if c.faults.LatencyJitter > 0 {
+		f.latency += time.Duration(c.rand.Int63n(int64(c.faults.LatencyJitter)))
+	}
+
+	switch {
+	case c.faults.PanicRate > 0 && c.rand.Float64() < c.faults.PanicRate:
+		f.panics = true
+	case c.faults.ErrorRate > 0 && c.rand.Float64() < c.faults.ErrorRate:
+		f.err = c.faults.Err
+		if f.err == nil {
+			f.err = ErrInjected
+		}
+	case c.faults.MalformedRate > 0 && c.rand.Float64() < c.faults.MalformedRate:
+		values := c.faults.MalformedValues
+		if len(values) == 0 {
+			values = DefaultMalformedValues
+		}
+		f.malformed = values[c.rand.Intn(len(values))]
+	}
+
+	return f
+}
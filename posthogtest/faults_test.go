@@ -0,0 +1,160 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package posthogtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	openfeatureposthog "github.com/dhaus67/openfeature-posthog-go"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/posthog/posthog-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultyClient(t *testing.T) {
+	payload := posthog.FeatureFlagPayload{Key: "flag", DistinctId: "12345"}
+
+	c := NewFaultyClient(NewClient(Flag{Key: "flag", Value: "10"}), Faults{Latency: 10 * time.Millisecond})
+	start := time.Now()
+	res, err := c.GetFeatureFlag(payload)
+	require.NoError(t, err)
+	assert.Equal(t, "10", res)
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+
+	c.SetFaults(Faults{ErrorRate: 1})
+	_, err = c.GetFeatureFlag(payload)
+	assert.ErrorIs(t, err, ErrInjected)
+
+	c.SetFaults(Faults{MalformedRate: 1, MalformedValues: []interface{}{42}})
+	res, err = c.GetFeatureFlag(payload)
+	require.NoError(t, err)
+	assert.Equal(t, 42, res)
+
+	c.SetFaults(Faults{PanicRate: 1})
+	assert.PanicsWithValue(t, ErrInjected, func() { _, _ = c.GetFeatureFlag(payload) })
+}
+
+func TestFaultyClient_Rates(t *testing.T) {
+	c := NewFaultyClient(NewClient(Flag{Key: "flag", Value: true}), Faults{ErrorRate: 0.5, Seed: 1})
+
+	var errs int
+	for i := 0; i < 1000; i++ {
+		if _, err := c.GetFeatureFlag(posthog.FeatureFlagPayload{Key: "flag", DistinctId: "12345"}); err != nil {
+			errs++
+		}
+	}
+	assert.InDelta(t, 500, errs, 100)
+}
+
+func TestFaultyClient_ProviderDegradesToDefaults(t *testing.T) {
+	c := NewFaultyClient(NewClient(
+		Flag{Key: "bool-flag", Value: true},
+		Flag{Key: "string-flag", Value: "posthog"},
+		Flag{Key: "int-flag", Value: "20"},
+		Flag{Key: "float-flag", Value: "0.55"},
+		Flag{Key: "object-flag", Value: `{"name": "posthog"}`},
+	), Faults{})
+	require.NoError(t, openfeature.SetNamedProviderAndWait(t.Name(), openfeatureposthog.NewProvider(c)))
+	client := openfeature.NewClient(t.Name())
+	evalCtx := openfeature.NewEvaluationContext("12345", nil)
+
+	tcs := map[string]struct {
+		faults    Faults
+		errorCode openfeature.ErrorCode
+	}{
+		"errors": {
+			faults:    Faults{ErrorRate: 1},
+			errorCode: openfeature.GeneralCode,
+		},
+		"panics": {
+			faults:    Faults{PanicRate: 1},
+			errorCode: openfeature.GeneralCode,
+		},
+		"malformed values": {
+			faults:    Faults{MalformedRate: 1, MalformedValues: []interface{}{42}},
+			errorCode: openfeature.TypeMismatchCode,
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			c.SetFaults(tc.faults)
+
+			b, err := client.BooleanValueDetails(context.Background(), "bool-flag", false, evalCtx)
+			assert.Error(t, err)
+			assert.False(t, b.Value)
+			assert.Equal(t, tc.errorCode, b.ErrorCode)
+
+			s, err := client.StringValueDetails(context.Background(), "string-flag", "default", evalCtx)
+			assert.Error(t, err)
+			assert.Equal(t, "default", s.Value)
+			assert.Equal(t, tc.errorCode, s.ErrorCode)
+
+			i, err := client.IntValueDetails(context.Background(), "int-flag", 10, evalCtx)
+			assert.Error(t, err)
+			assert.Equal(t, int64(10), i.Value)
+			assert.Equal(t, tc.errorCode, i.ErrorCode)
+
+			f, err := client.FloatValueDetails(context.Background(), "float-flag", 0.1, evalCtx)
+			assert.Error(t, err)
+			assert.Equal(t, 0.1, f.Value)
+			assert.Equal(t, tc.errorCode, f.ErrorCode)
+
+			// Evaluations with cancelable contexts, as of HTTP requests, degrade the same way.
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			s, err = client.StringValueDetails(ctx, "string-flag", "default", evalCtx)
+			assert.Error(t, err)
+			assert.Equal(t, "default", s.Value)
+			assert.Equal(t, tc.errorCode, s.ErrorCode)
+		})
+	}
+
+	objectTcs := map[string]struct {
+		faults    Faults
+		errorCode openfeature.ErrorCode
+	}{
+		"errors": {
+			faults:    Faults{ErrorRate: 1},
+			errorCode: openfeature.GeneralCode,
+		},
+		"panics": {
+			faults:    Faults{PanicRate: 1},
+			errorCode: openfeature.GeneralCode,
+		},
+		"invalid JSON": {
+			faults:    Faults{MalformedRate: 1, MalformedValues: []interface{}{"{invalid json"}},
+			errorCode: openfeature.TypeMismatchCode,
+		},
+		"non-JSON value": {
+			faults:    Faults{MalformedRate: 1, MalformedValues: []interface{}{make(chan int)}},
+			errorCode: openfeature.TypeMismatchCode,
+		},
+	}
+
+	for name, tc := range objectTcs {
+		t.Run("object "+name, func(t *testing.T) {
+			c.SetFaults(tc.faults)
+
+			o, err := client.ObjectValueDetails(context.Background(), "object-flag", map[string]interface{}{"name": "default"}, evalCtx)
+			assert.Error(t, err)
+			assert.Equal(t, map[string]interface{}{"name": "default"}, o.Value)
+			assert.Equal(t, tc.errorCode, o.ErrorCode)
+		})
+	}
+}
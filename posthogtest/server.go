@@ -0,0 +1,268 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package posthogtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/posthog/posthog-go"
+)
+
+// ServerConfig configures the flags and definitions served by a Server. It can be loaded from a JSON fixture.
+type ServerConfig struct {
+	// APIKey is the project API key expected by the server. If empty, any key is accepted.
+	APIKey string `json:"api_key"`
+	// PersonalAPIKey is the personal API key expected for local evaluation. If empty, any key is accepted.
+	PersonalAPIKey string `json:"personal_api_key"`
+	// Flags are evaluated by the /decide and /flags endpoints.
+	Flags []Flag `json:"flags"`
+	// Definitions are served by /api/feature_flag/local_evaluation to clients configured with a personal API key.
+	Definitions []posthog.FeatureFlag `json:"definitions"`
+	// GroupTypeMapping maps group type indexes to group types for local evaluation.
+	GroupTypeMapping map[string]string `json:"group_type_mapping"`
+	// Cohorts referenced by the definitions.
+	Cohorts map[string]posthog.PropertyGroup `json:"cohorts"`
+}
+
+// LoadServerConfig reads a ServerConfig from a JSON fixture.
+func LoadServerConfig(path string) (ServerConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+
+	var config ServerConfig
+	if err := json.Unmarshal(b, &config); err != nil {
+		return ServerConfig{}, fmt.Errorf("parsing fixture %q: %w", path, err)
+	}
+	return config, nil
+}
+
+// Server is a local stand-in for the PostHog API. Clients created with posthog.NewWithConfig can be pointed at it by
+// using the server's URL as the endpoint.
+type Server struct {
+	*httptest.Server
+
+	flags *Client
+
+	mu     sync.RWMutex
+	config ServerConfig
+	events []map[string]interface{}
+}
+
+// NewServer starts a new server with the given configuration. The server must be closed by the caller.
+func NewServer(config ServerConfig) *Server {
+	s := &Server{
+		flags:  NewClient(config.Flags...),
+		config: config,
+	}
+
+	mux := http.NewServeMux()
+	for _, path := range []string{"/decide", "/decide/"} {
+		mux.HandleFunc("POST "+path, s.handleDecide)
+	}
+	for _, path := range []string{"/flags", "/flags/"} {
+		mux.HandleFunc("POST "+path, s.handleFlags)
+	}
+	for _, path := range []string{"/batch", "/batch/"} {
+		mux.HandleFunc("POST "+path, s.handleBatch)
+	}
+	mux.HandleFunc("GET /api/feature_flag/local_evaluation", s.handleLocalEvaluation)
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// NewServerFromFixture starts a new server with the configuration read from the JSON fixture.
+func NewServerFromFixture(path string) (*Server, error) {
+	config, err := LoadServerConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(config), nil
+}
+
+// SetFlag adds the flag or replaces an existing flag with the same key.
+func (s *Server) SetFlag(flag Flag) {
+	s.flags.SetFlag(flag)
+}
+
+// DeleteFlag removes the flag with the given key.
+func (s *Server) DeleteFlag(key string) {
+	s.flags.DeleteFlag(key)
+}
+
+// SetDefinitions replaces the definitions served for local evaluation.
+func (s *Server) SetDefinitions(definitions []posthog.FeatureFlag) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config.Definitions = definitions
+}
+
+// Events returns all events received via /batch, as decoded JSON objects.
+func (s *Server) Events() []map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]map[string]interface{}(nil), s.events...)
+}
+
+// Captures returns all received capture events with the given event name. An empty name returns all captures.
+func (s *Server) Captures(event string) []map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var captures []map[string]interface{}
+	for _, e := range s.events {
+		if e["type"] != "capture" {
+			continue
+		}
+		if event == "" || e["event"] == event {
+			captures = append(captures, e)
+		}
+	}
+	return captures
+}
+
+type decideResponse struct {
+	FeatureFlags        map[string]interface{} `json:"featureFlags"`
+	FeatureFlagPayloads map[string]string      `json:"featureFlagPayloads"`
+}
+
+type flagsResponse struct {
+	Flags                     map[string]flagDetail `json:"flags"`
+	ErrorsWhileComputingFlags bool                  `json:"errorsWhileComputingFlags"`
+}
+
+type flagDetail struct {
+	Key      string       `json:"key"`
+	Enabled  bool         `json:"enabled"`
+	Variant  *string      `json:"variant"`
+	Metadata flagMetadata `json:"metadata"`
+}
+
+type flagMetadata struct {
+	Payload string `json:"payload,omitempty"`
+}
+
+func (s *Server) handleDecide(w http.ResponseWriter, r *http.Request) {
+	values, payloads, ok := s.evaluateRequest(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, decideResponse{FeatureFlags: values, FeatureFlagPayloads: payloads})
+}
+
+func (s *Server) handleFlags(w http.ResponseWriter, r *http.Request) {
+	values, payloads, ok := s.evaluateRequest(w, r)
+	if !ok {
+		return
+	}
+
+	res := flagsResponse{Flags: make(map[string]flagDetail, len(values))}
+	for key, value := range values {
+		detail := flagDetail{Key: key, Metadata: flagMetadata{Payload: payloads[key]}}
+		switch v := value.(type) {
+		case bool:
+			detail.Enabled = v
+		default:
+			variant := fmt.Sprint(v)
+			detail.Enabled = true
+			detail.Variant = &variant
+		}
+		res.Flags[key] = detail
+	}
+	writeJSON(w, res)
+}
+
+func (s *Server) handleLocalEvaluation(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.authorized(r.URL.Query().Get("token"), s.config.APIKey) ||
+		!s.authorized(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), s.config.PersonalAPIKey) {
+		http.Error(w, "invalid API key", http.StatusUnauthorized)
+		return
+	}
+
+	flags := s.config.Definitions
+	if flags == nil {
+		flags = []posthog.FeatureFlag{}
+	}
+	groupTypeMapping := s.config.GroupTypeMapping
+	if groupTypeMapping == nil {
+		groupTypeMapping = map[string]string{}
+	}
+	writeJSON(w, posthog.FeatureFlagsResponse{
+		Flags:            flags,
+		GroupTypeMapping: &groupTypeMapping,
+		Cohorts:          s.config.Cohorts,
+	})
+}
+
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		APIKey string                   `json:"api_key"`
+		Batch  []map[string]interface{} `json:"batch"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.authorized(req.APIKey, s.config.APIKey) {
+		http.Error(w, "invalid API key", http.StatusUnauthorized)
+		return
+	}
+	s.events = append(s.events, req.Batch...)
+	writeJSON(w, map[string]int{"status": 1})
+}
+
+func (s *Server) evaluateRequest(w http.ResponseWriter, r *http.Request) (map[string]interface{}, map[string]string, bool) {
+	var req posthog.DecideRequestData
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	s.mu.RLock()
+	authorized := s.authorized(req.ApiKey, s.config.APIKey)
+	s.mu.RUnlock()
+	if !authorized {
+		http.Error(w, "invalid API key", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+
+	values, payloads := s.flags.evaluateAll(req.DistinctId, req.Groups, req.PersonProperties, req.GroupProperties)
+	return values, payloads, true
+}
+
+func (s *Server) authorized(key, expected string) bool {
+	return expected == "" || key == expected
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package posthogtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	openfeatureposthog "github.com/dhaus67/openfeature-posthog-go"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/posthog/posthog-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Decide(t *testing.T) {
+	s, err := NewServerFromFixture("testdata/server.json")
+	require.NoError(t, err)
+	defer s.Close()
+
+	client, err := posthog.NewWithConfig("project-key", posthog.Config{Endpoint: s.URL})
+	require.NoError(t, err)
+
+	require.NoError(t, openfeature.SetNamedProviderAndWait(t.Name(), openfeatureposthog.NewProvider(client)))
+	c := openfeature.NewClient(t.Name())
+
+	res, err := c.StringValue(context.Background(), "variant-flag", "default", openfeature.NewEvaluationContext("beta-user", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "beta", res)
+
+	res, err = c.StringValue(context.Background(), "variant-flag", "default", openfeature.NewEvaluationContext("12345", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "control", res)
+
+	payload, err := client.GetFeatureFlagPayload(posthog.FeatureFlagPayload{Key: "variant-flag", DistinctId: "beta-user"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"color": "red"}`, payload)
+
+	// Closing the client flushes the $feature_flag_called events to the batch endpoint.
+	require.NoError(t, client.Close())
+	calls := s.Captures(FeatureFlagCalledEvent)
+	require.Len(t, calls, 2)
+	assert.ElementsMatch(t, []interface{}{"beta-user", "12345"}, []interface{}{calls[0]["distinct_id"], calls[1]["distinct_id"]})
+}
+
+func TestServer_LocalEvaluation(t *testing.T) {
+	s, err := NewServerFromFixture("testdata/server.json")
+	require.NoError(t, err)
+	defer s.Close()
+
+	client, err := posthog.NewWithConfig("project-key", posthog.Config{Endpoint: s.URL, PersonalApiKey: "personal-key"})
+	require.NoError(t, err)
+	defer client.Close()
+
+	res, err := client.GetFeatureFlag(posthog.FeatureFlagPayload{Key: "local-flag", DistinctId: "12345", OnlyEvaluateLocally: true})
+	require.NoError(t, err)
+	assert.Equal(t, true, res)
+}
+
+func TestServer_Flags(t *testing.T) {
+	s := NewServer(ServerConfig{Flags: []Flag{
+		{Key: "bool-flag", Value: true},
+		{Key: "variant-flag", Value: "control", Payload: "1"},
+		{Key: "disabled-flag"},
+	}})
+	defer s.Close()
+
+	body, err := json.Marshal(posthog.DecideRequestData{DistinctId: "12345"})
+	require.NoError(t, err)
+	resp, err := http.Post(s.URL+"/flags/?v=2", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var res flagsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	control := "control"
+	assert.Equal(t, map[string]flagDetail{
+		"bool-flag":     {Key: "bool-flag", Enabled: true},
+		"variant-flag":  {Key: "variant-flag", Enabled: true, Variant: &control, Metadata: flagMetadata{Payload: "1"}},
+		"disabled-flag": {Key: "disabled-flag"},
+	}, res.Flags)
+}
+
+func TestServer_InvalidAPIKey(t *testing.T) {
+	s := NewServer(ServerConfig{APIKey: "project-key", Flags: []Flag{{Key: "flag", Value: true}}})
+	defer s.Close()
+
+	client, err := posthog.NewWithConfig("other-key", posthog.Config{Endpoint: s.URL})
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.GetFeatureFlag(posthog.FeatureFlagPayload{Key: "flag", DistinctId: "12345"})
+	assert.Error(t, err)
+}
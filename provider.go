@@ -32,8 +32,12 @@ const (
 	PropertiesContextKey = "properties"
 )
 
+const eventBufferSize = 16
+
 var (
 	_ openfeature.FeatureProvider = (*Provider)(nil)
+	_ openfeature.EventHandler    = (*Provider)(nil)
+	_ openfeature.StateHandler    = (*Provider)(nil)
 
 	errMissingTargetKey  = errors.New("missing target key in evaluation context")
 	errInvalidGroups     = errors.New("invalid groups in evaluation context")
@@ -46,14 +50,36 @@ type PostHogProperties struct {
 }
 
 type Provider struct {
-	client posthog.Client
+	// events must stay the first field: the OpenFeature SDK compares providers with reflect.DeepEqual when routing
+	// events, which then stops at the unique channel instead of reading the mutable state of the other fields.
+	events        chan openfeature.Event
+	client        posthog.Client
+	breaker       *circuitBreaker
+	retrier       *retrier
+	fallback      FallbackStore
+	cache         *resultCache
+	snapshot      *definitionsSnapshot
+	bootstrap     *Bootstrap
+	overrides     *localOverrides
+	remoteConfig  *RemoteConfig
+	schemas       map[string]*Schema
+	mergeDefaults bool
+	definitions   definitionsBackoff
 }
 
+// Option configures optional behavior of the Provider.
+type Option func(*Provider)
+
 // NewProvider creates a new PostHog provider.
-func NewProvider(client posthog.Client) *Provider {
-	return &Provider{
+func NewProvider(client posthog.Client, opts ...Option) *Provider {
+	p := &Provider{
 		client: client,
+		events: make(chan openfeature.Event, eventBufferSize),
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	return p
 }
 
 // Metadata returns the providers metadata.
@@ -68,7 +94,59 @@ func (p *Provider) Hooks() []openfeature.Hook {
 	return []openfeature.Hook{}
 }
 
-func (p *Provider) BooleanEvaluation(_ context.Context, flag string, defaultValue bool, evalCtx openfeature.FlattenedContext) openfeature.BoolResolutionDetail {
+// Init bootstraps the provider from the definitions snapshot, if configured, and starts persisting the live
+// definitions once they are loaded. Init does not wait for the live definitions. It fails if the local overrides
+// could not be loaded or remote config is configured without a client supporting it.
+func (p *Provider) Init(openfeature.EvaluationContext) error {
+	if p.overrides != nil && p.overrides.err != nil {
+		return p.overrides.err
+	}
+	if p.remoteConfig != nil && p.remoteConfig.Client == nil {
+		return errRemoteConfigUnsupported
+	}
+	if p.snapshot == nil {
+		return nil
+	}
+
+	p.snapshot.start(p.client)
+	return nil
+}
+
+// Shutdown stops loading the live definitions for the snapshot, if configured. The PostHog client is owned and closed
+// by the caller.
+func (p *Provider) Shutdown() {
+	if p.snapshot != nil {
+		p.snapshot.shutdown()
+	}
+}
+
+// Status returns the state of the provider. It is in the error state while the circuit breaker, if configured, is not
+// closed, matching the PROVIDER_ERROR and PROVIDER_READY events, and ready otherwise.
+func (p *Provider) Status() openfeature.State {
+	if p.breaker != nil && !p.breaker.closed() {
+		return openfeature.ErrorState
+	}
+	return openfeature.ReadyState
+}
+
+// EventChannel returns the channel on which the provider emits its events.
+func (p *Provider) EventChannel() <-chan openfeature.Event {
+	return p.events
+}
+
+// emit sends the event without blocking. Events are dropped if nobody consumes them.
+func (p *Provider) emit(eventType openfeature.EventType, details openfeature.ProviderEventDetails) {
+	select {
+	case p.events <- openfeature.Event{
+		ProviderName:         p.Metadata().Name,
+		EventType:            eventType,
+		ProviderEventDetails: details,
+	}:
+	default:
+	}
+}
+
+func (p *Provider) BooleanEvaluation(ctx context.Context, flag string, defaultValue bool, evalCtx openfeature.FlattenedContext) openfeature.BoolResolutionDetail {
 	payload, err := translateFeatureFlagPayload(evalCtx, flag)
 	if err != nil {
 		if errors.Is(err, errMissingTargetKey) {
@@ -92,7 +170,7 @@ func (p *Provider) BooleanEvaluation(_ context.Context, flag string, defaultValu
 
 	// For boolean flags, we cannot properly evaluate whether the flag was found or not since the API always returns false.
 	// This would create additional errors, so we skip the explicit check.
-	res, _, err := p.getFeatureFlag(payload)
+	res, err := p.getFeatureFlag(ctx, payload)
 	if err != nil {
 		return openfeature.BoolResolutionDetail{
 			Value: defaultValue,
@@ -104,10 +182,10 @@ func (p *Provider) BooleanEvaluation(_ context.Context, flag string, defaultValu
 	}
 
 	var parsedValue bool
-	if boolValue, ok := res.(bool); ok {
+	if boolValue, ok := res.value.(bool); ok {
 		parsedValue = boolValue
 	} else {
-		boolValue, resolutionErr := parseFlagValue[bool](res)
+		boolValue, resolutionErr := parseFlagValue[bool](res.value)
 		if resolutionErr != nil {
 			return openfeature.BoolResolutionDetail{
 				Value: defaultValue,
@@ -123,12 +201,13 @@ func (p *Provider) BooleanEvaluation(_ context.Context, flag string, defaultValu
 	return openfeature.BoolResolutionDetail{
 		Value: parsedValue,
 		ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
-			Reason: openfeature.TargetingMatchReason,
+			Reason:       res.reason,
+			FlagMetadata: res.metadata,
 		},
 	}
 }
 
-func (p *Provider) FloatEvaluation(_ context.Context, flag string, defaultValue float64, evalCtx openfeature.FlattenedContext) openfeature.FloatResolutionDetail {
+func (p *Provider) FloatEvaluation(ctx context.Context, flag string, defaultValue float64, evalCtx openfeature.FlattenedContext) openfeature.FloatResolutionDetail {
 	payload, err := translateFeatureFlagPayload(evalCtx, flag)
 	if err != nil {
 		return openfeature.FloatResolutionDetail{
@@ -140,7 +219,7 @@ func (p *Provider) FloatEvaluation(_ context.Context, flag string, defaultValue
 		}
 	}
 
-	res, found, err := p.getFeatureFlag(payload)
+	res, err := p.getFeatureFlag(ctx, payload)
 	if err != nil {
 		return openfeature.FloatResolutionDetail{
 			Value: defaultValue,
@@ -151,7 +230,7 @@ func (p *Provider) FloatEvaluation(_ context.Context, flag string, defaultValue
 		}
 	}
 
-	if !found {
+	if !res.found {
 		return openfeature.FloatResolutionDetail{
 			Value: defaultValue,
 			ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
@@ -161,7 +240,7 @@ func (p *Provider) FloatEvaluation(_ context.Context, flag string, defaultValue
 		}
 	}
 
-	parsedValue, resolutionErr := parseFlagValue[float64](res)
+	parsedValue, resolutionErr := parseFlagValue[float64](res.value)
 	if resolutionErr != nil {
 		return openfeature.FloatResolutionDetail{
 			Value: defaultValue,
@@ -175,12 +254,13 @@ func (p *Provider) FloatEvaluation(_ context.Context, flag string, defaultValue
 	return openfeature.FloatResolutionDetail{
 		Value: parsedValue,
 		ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
-			Reason: openfeature.TargetingMatchReason,
+			Reason:       res.reason,
+			FlagMetadata: res.metadata,
 		},
 	}
 }
 
-func (p *Provider) IntEvaluation(_ context.Context, flag string, defaultValue int64, evalCtx openfeature.FlattenedContext) openfeature.IntResolutionDetail {
+func (p *Provider) IntEvaluation(ctx context.Context, flag string, defaultValue int64, evalCtx openfeature.FlattenedContext) openfeature.IntResolutionDetail {
 	payload, err := translateFeatureFlagPayload(evalCtx, flag)
 	if err != nil {
 		return openfeature.IntResolutionDetail{
@@ -192,7 +272,7 @@ func (p *Provider) IntEvaluation(_ context.Context, flag string, defaultValue in
 		}
 	}
 
-	res, found, err := p.getFeatureFlag(payload)
+	res, err := p.getFeatureFlag(ctx, payload)
 	if err != nil {
 		return openfeature.IntResolutionDetail{
 			Value: defaultValue,
@@ -203,7 +283,7 @@ func (p *Provider) IntEvaluation(_ context.Context, flag string, defaultValue in
 		}
 	}
 
-	if !found {
+	if !res.found {
 		return openfeature.IntResolutionDetail{
 			Value: defaultValue,
 			ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
@@ -213,7 +293,7 @@ func (p *Provider) IntEvaluation(_ context.Context, flag string, defaultValue in
 		}
 	}
 
-	parsedValue, resolutionErr := parseFlagValue[int64](res)
+	parsedValue, resolutionErr := parseFlagValue[int64](res.value)
 	if resolutionErr != nil {
 		return openfeature.IntResolutionDetail{
 			Value: defaultValue,
@@ -227,13 +307,23 @@ func (p *Provider) IntEvaluation(_ context.Context, flag string, defaultValue in
 	return openfeature.IntResolutionDetail{
 		Value: parsedValue,
 		ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
-			Reason: openfeature.TargetingMatchReason,
+			Reason:       res.reason,
+			FlagMetadata: res.metadata,
 		},
 	}
 }
 
-func (p *Provider) ObjectEvaluation(_ context.Context, flag string, defaultValue interface{}, evalCtx openfeature.FlattenedContext) openfeature.InterfaceResolutionDetail {
-	payload, err := translateFeatureFlagPayload(evalCtx, flag)
+func (p *Provider) ObjectEvaluation(ctx context.Context, flag string, defaultValue interface{}, evalCtx openfeature.FlattenedContext) openfeature.InterfaceResolutionDetail {
+	var res flagResult
+	var err error
+	if p.isRemoteConfig(flag) {
+		res, err = p.getRemoteConfig(ctx, flag)
+	} else {
+		var payload posthog.FeatureFlagPayload
+		if payload, err = translateFeatureFlagPayload(evalCtx, flag); err == nil {
+			res, err = p.getFeatureFlag(ctx, payload)
+		}
+	}
 	if err != nil {
 		return openfeature.InterfaceResolutionDetail{
 			Value: defaultValue,
@@ -243,34 +333,39 @@ func (p *Provider) ObjectEvaluation(_ context.Context, flag string, defaultValue
 			},
 		}
 	}
+	return p.resolveObject(flag, res, defaultValue)
+}
 
-	res, found, err := p.getFeatureFlag(payload)
-	if err != nil {
+// resolveObject decodes the value of the object flag, merges it over the default value if configured and validates it
+// against the schema of the flag. It is shared by ObjectEvaluation and the OFREP handler.
+func (p *Provider) resolveObject(flag string, res flagResult, defaultValue interface{}) openfeature.InterfaceResolutionDetail {
+	if !res.found {
 		return openfeature.InterfaceResolutionDetail{
 			Value: defaultValue,
 			ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
-				ResolutionError: openfeature.NewGeneralResolutionError(err.Error()),
-				Reason:          openfeature.ErrorReason,
+				ResolutionError: openfeature.NewFlagNotFoundResolutionError(fmt.Sprintf("%q not found", flag)),
+				Reason:          openfeature.DefaultReason,
 			},
 		}
 	}
 
-	if !found {
+	obj, err := decodeObjectValue(res.value)
+	if err != nil {
 		return openfeature.InterfaceResolutionDetail{
 			Value: defaultValue,
 			ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
-				ResolutionError: openfeature.NewFlagNotFoundResolutionError(fmt.Sprintf("%q not found", flag)),
-				Reason:          openfeature.DefaultReason,
+				ResolutionError: openfeature.NewTypeMismatchResolutionError(err.Error()),
+				Reason:          openfeature.ErrorReason,
 			},
 		}
 	}
 
-	var obj map[string]interface{}
-	if err := json.Unmarshal([]byte(res.(string)), &obj); err != nil {
+	obj = p.mergeObjectDefaults(obj, defaultValue)
+	if err := p.validateSchema(flag, obj); err != nil {
 		return openfeature.InterfaceResolutionDetail{
 			Value: defaultValue,
 			ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
-				ResolutionError: openfeature.NewTypeMismatchResolutionError("invalid JSON as flag value"),
+				ResolutionError: openfeature.NewTypeMismatchResolutionError(err.Error()),
 				Reason:          openfeature.ErrorReason,
 			},
 		}
@@ -279,12 +374,13 @@ func (p *Provider) ObjectEvaluation(_ context.Context, flag string, defaultValue
 	return openfeature.InterfaceResolutionDetail{
 		Value: obj,
 		ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
-			Reason: openfeature.TargetingMatchReason,
+			Reason:       res.reason,
+			FlagMetadata: res.metadata,
 		},
 	}
 }
 
-func (p *Provider) StringEvaluation(_ context.Context, flag string, defaultValue string, evalCtx openfeature.FlattenedContext) openfeature.StringResolutionDetail {
+func (p *Provider) StringEvaluation(ctx context.Context, flag string, defaultValue string, evalCtx openfeature.FlattenedContext) openfeature.StringResolutionDetail {
 	payload, err := translateFeatureFlagPayload(evalCtx, flag)
 	if err != nil {
 		return openfeature.StringResolutionDetail{
@@ -296,7 +392,7 @@ func (p *Provider) StringEvaluation(_ context.Context, flag string, defaultValue
 		}
 	}
 
-	res, found, err := p.getFeatureFlag(payload)
+	res, err := p.getFeatureFlag(ctx, payload)
 	if err != nil {
 		return openfeature.StringResolutionDetail{
 			Value: defaultValue,
@@ -307,7 +403,7 @@ func (p *Provider) StringEvaluation(_ context.Context, flag string, defaultValue
 		}
 	}
 
-	if !found {
+	if !res.found {
 		return openfeature.StringResolutionDetail{
 			Value: defaultValue,
 			ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
@@ -317,7 +413,7 @@ func (p *Provider) StringEvaluation(_ context.Context, flag string, defaultValue
 		}
 	}
 
-	parsedValue, resolutionErr := parseFlagValue[string](res)
+	parsedValue, resolutionErr := parseFlagValue[string](res.value)
 	if resolutionErr != nil {
 		return openfeature.StringResolutionDetail{
 			Value: defaultValue,
@@ -331,24 +427,153 @@ func (p *Provider) StringEvaluation(_ context.Context, flag string, defaultValue
 	return openfeature.StringResolutionDetail{
 		Value: parsedValue,
 		ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
-			Reason: openfeature.TargetingMatchReason,
+			Reason:       res.reason,
+			FlagMetadata: res.metadata,
 		},
 	}
 }
 
-func (p *Provider) getFeatureFlag(payload posthog.FeatureFlagPayload) (interface{}, bool, error) {
-	res, err := p.client.GetFeatureFlag(payload)
+// flagResult is the outcome of evaluating a flag with PostHog.
+type flagResult struct {
+	value    interface{}
+	found    bool
+	reason   openfeature.Reason
+	metadata openfeature.FlagMetadata
+}
+
+func (p *Provider) getFeatureFlag(ctx context.Context, payload posthog.FeatureFlagPayload) (flagResult, error) {
+	if res, ok := p.override(ctx, payload.Key); ok {
+		return res, nil
+	}
+
+	if p.snapshot != nil {
+		if res, ok := p.snapshot.evaluate(payload); ok {
+			if res, ok := res.(bool); ok && !res {
+				return flagResult{value: res, reason: openfeature.CachedReason}, nil
+			}
+			return flagResult{value: res, found: true, reason: openfeature.CachedReason}, nil
+		}
+	}
+
+	return p.fetchWithFallbacks(ctx, payload, openfeature.TargetingMatchReason, p.fetchFeatureFlag)
+}
+
+// override returns the overridden value of the flag, if any. Request overrides take precedence over local overrides.
+func (p *Provider) override(ctx context.Context, flag string) (flagResult, bool) {
+	if value, ok := requestOverride(ctx, flag); ok {
+		return overrideResult(value, RequestOverrideSource), true
+	}
+	if p.overrides != nil {
+		if value, source, ok := p.overrides.lookup(flag); ok {
+			return overrideResult(value, source), true
+		}
+	}
+	return flagResult{}, false
+}
+
+// fetchWithFallbacks fetches the flag through the cache, if configured, and falls back to the last resort values if
+// fetching fails. Fetched values are reported with the given reason.
+func (p *Provider) fetchWithFallbacks(ctx context.Context, payload posthog.FeatureFlagPayload, reason openfeature.Reason,
+	fetch func(context.Context, posthog.FeatureFlagPayload) (interface{}, error)) (flagResult, error) {
+	var res interface{}
+	var err error
+	if p.cache != nil {
+		var cached bool
+		res, cached, err = p.cache.get(ctx, payload, fetch)
+		if cached {
+			reason = openfeature.CachedReason
+		}
+	} else {
+		res, err = fetch(ctx, payload)
+	}
+
 	if err != nil {
-		return res, false, err
+		var ok bool
+		res, reason, ok = p.lastResort(payload)
+		if !ok {
+			return flagResult{value: res}, err
+		}
 	}
 
 	// In case the flag could not be found, the client will return false for the flag value.
 	// Unfortunately, there is no way of distinction for flag not found or boolean value false.
 	if res, ok := res.(bool); ok && !res {
-		return res, false, nil
+		return flagResult{value: res, reason: reason}, nil
+	}
+
+	return flagResult{value: res, found: true, reason: reason}, nil
+}
+
+func overrideResult(value interface{}, source string) flagResult {
+	res, ok := value.(bool)
+	return flagResult{
+		value:    value,
+		found:    !ok || res,
+		reason:   OverrideReason,
+		metadata: openfeature.FlagMetadata{SourceMetadataKey: source},
+	}
+}
+
+// lastResort returns the value served when PostHog failed to evaluate the flag: the last known value of the fallback
+// store or the bootstrap value, if configured.
+func (p *Provider) lastResort(payload posthog.FeatureFlagPayload) (interface{}, openfeature.Reason, bool) {
+	if p.fallback != nil {
+		if stale, ok := p.fallback.Load(payload.Key, payload.DistinctId); ok {
+			return stale, StaleReason, true
+		}
+	}
+	if p.bootstrap != nil {
+		if value, ok := p.bootstrap.lookup(payload.Key, payload.DistinctId); ok {
+			return value, openfeature.StaticReason, true
+		}
+	}
+	return nil, "", false
+}
+
+// fetchFeatureFlag evaluates the flag with PostHog and keeps successful results in the fallback store, if configured.
+func (p *Provider) fetchFeatureFlag(ctx context.Context, payload posthog.FeatureFlagPayload) (interface{}, error) {
+	res, err := p.callClient(ctx, func() (interface{}, error) {
+		return p.client.GetFeatureFlag(payload)
+	})
+	if err == nil && p.fallback != nil {
+		p.fallback.Store(payload.Key, payload.DistinctId, res)
+	}
+	return res, err
+}
+
+// callClient calls PostHog with the retrier, if configured.
+func (p *Provider) callClient(ctx context.Context, call func() (interface{}, error)) (interface{}, error) {
+	if p.retrier == nil {
+		return p.callGuarded(ctx, call)
+	}
+
+	return p.retrier.do(ctx, func() (interface{}, error) {
+		return p.callGuarded(ctx, call)
+	})
+}
+
+// callGuarded calls PostHog guarded by the circuit breaker, if configured. Calls are only bound by the context if the
+// circuit breaker has a timeout, since abandoned calls keep running in the background.
+func (p *Provider) callGuarded(ctx context.Context, call func() (interface{}, error)) (interface{}, error) {
+	if p.breaker == nil {
+		return callRecovered(call)
+	}
+
+	if err := p.breaker.allow(); err != nil {
+		return nil, err
 	}
 
-	return res, true, nil
+	var res interface{}
+	var err error
+	if p.breaker.config.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(ctx, p.breaker.config.Timeout)
+		defer cancel()
+		res, err = callWithContext(ctx, call)
+	} else {
+		res, err = callRecovered(call)
+	}
+	p.breaker.record(err)
+	return res, err
 }
 
 func translateFeatureFlagPayload(evalCtx openfeature.FlattenedContext, key string) (posthog.FeatureFlagPayload, error) {
@@ -421,3 +646,23 @@ func parseFlagValue[T any](v interface{}) (T, *openfeature.ResolutionError) {
 		return *new(T), &err
 	}
 }
+
+// decodeObjectValue decodes the flag value into a JSON value: an object, array, string, number, boolean or nil.
+// Strings returned by PostHog are decoded as JSON, values already decoded by the client are normalized to the types
+// produced by encoding/json.
+func decodeObjectValue(v interface{}) (interface{}, error) {
+	b, ok := v.(string)
+	if !ok {
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("%T is not a JSON value", v)
+		}
+		b = string(encoded)
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(b), &decoded); err != nil {
+		return nil, errors.New("invalid JSON as flag value")
+	}
+	return decoded, nil
+}
@@ -16,6 +16,8 @@ package openfeatureposthog
 
 import (
 	"context"
+	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/open-feature/go-sdk/openfeature"
@@ -107,7 +109,7 @@ func TestProvider_BooleanEvaluation(t *testing.T) {
 		},
 	}
 
-	mockClient := &mockPostHogClient{t: t}
+	mockClient := &mockPostHogClient{}
 	p := NewProvider(mockClient)
 	require.NoError(t, openfeature.SetProvider(p))
 	c := openfeature.NewClient("testing")
@@ -208,7 +210,7 @@ func TestProvider_FloatEvaluation(t *testing.T) {
 		},
 	}
 
-	mockClient := &mockPostHogClient{t: t}
+	mockClient := &mockPostHogClient{}
 	p := NewProvider(mockClient)
 	require.NoError(t, openfeature.SetProvider(p))
 	c := openfeature.NewClient("testing")
@@ -283,7 +285,7 @@ func TestProvider_StringEvaluation(t *testing.T) {
 		},
 	}
 
-	mockClient := &mockPostHogClient{t: t}
+	mockClient := &mockPostHogClient{}
 	p := NewProvider(mockClient)
 	require.NoError(t, openfeature.SetProvider(p))
 	c := openfeature.NewClient("testing")
@@ -384,7 +386,7 @@ func TestProvider_IntEvaluation(t *testing.T) {
 		},
 	}
 
-	mockClient := &mockPostHogClient{t: t}
+	mockClient := &mockPostHogClient{}
 	p := NewProvider(mockClient)
 	require.NoError(t, openfeature.SetProvider(p))
 	c := openfeature.NewClient("testing")
@@ -485,7 +487,7 @@ func TestProvider_ObjectEvaluation(t *testing.T) {
 		},
 	}
 
-	mockClient := &mockPostHogClient{t: t}
+	mockClient := &mockPostHogClient{}
 	p := NewProvider(mockClient)
 	require.NoError(t, openfeature.SetProvider(p))
 	c := openfeature.NewClient("testing")
@@ -500,10 +502,48 @@ func TestProvider_ObjectEvaluation(t *testing.T) {
 	}
 }
 
+func TestProvider_ObjectEvaluationJSONValues(t *testing.T) {
+	tcs := map[string]struct {
+		res      interface{}
+		expected interface{}
+		err      string
+	}{
+		"array":           {res: `["alice", "bob"]`, expected: []interface{}{"alice", "bob"}},
+		"number":          {res: `42`, expected: float64(42)},
+		"boolean":         {res: `true`, expected: true},
+		"null":            {res: `null`, expected: nil},
+		"string":          {res: `"text"`, expected: "text"},
+		"decoded boolean": {res: true, expected: true},
+		"decoded value":   {res: map[string]interface{}{"allow": []string{"alice"}}, expected: map[string]interface{}{"allow": []interface{}{"alice"}}},
+		"variant key":     {res: "control", expected: "default", err: "TYPE_MISMATCH: invalid JSON as flag value"},
+		"not JSON":        {res: func() {}, expected: "default", err: "TYPE_MISMATCH: func() is not a JSON value"},
+	}
+
+	mockClient := &mockPostHogClient{}
+	p := NewProvider(mockClient)
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			mockClient.settings = mockSettings{
+				payload: posthog.FeatureFlagPayload{Key: "object-flag", DistinctId: "12345"},
+				res:     tc.res,
+			}
+			res := p.ObjectEvaluation(context.Background(), "object-flag", "default", openfeature.FlattenedContext{DistinctIDContextKey: "12345"})
+			assert.Equal(t, tc.expected, res.Value)
+			if tc.err == "" {
+				assert.NoError(t, res.Error())
+				return
+			}
+			assert.EqualError(t, res.Error(), tc.err)
+		})
+	}
+}
+
+// mockPostHogClient returns the configured result for the expected payload. It must not hold a *testing.T, since the
+// OpenFeature SDK deep-compares registered providers concurrently to the tests.
 type mockPostHogClient struct {
 	posthog.Client
 
-	t        *testing.T
 	settings mockSettings
 }
 
@@ -513,6 +553,8 @@ type mockSettings struct {
 }
 
 func (m *mockPostHogClient) GetFeatureFlag(payload posthog.FeatureFlagPayload) (interface{}, error) {
-	assert.Equal(m.t, m.settings.payload, payload)
+	if !reflect.DeepEqual(m.settings.payload, payload) {
+		return nil, fmt.Errorf("unexpected payload %+v, expected %+v", payload, m.settings.payload)
+	}
 	return m.settings.res, nil
 }
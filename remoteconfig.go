@@ -0,0 +1,84 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/posthog/posthog-go"
+)
+
+var errRemoteConfigUnsupported = errors.New("PostHog client does not support remote config payloads")
+
+// RemoteConfigClient fetches the payloads of remote config flags. It is implemented by the fake client of the
+// posthogtest package, but not by the PostHog client in the version required by this module.
+type RemoteConfigClient interface {
+	GetRemoteConfigPayload(flagKey string) (string, error)
+}
+
+// RemoteConfig configures the evaluation of remote config flags.
+type RemoteConfig struct {
+	// KeyPrefix identifies remote config flags by the prefix of their key, e.g. "config-". Required.
+	KeyPrefix string
+	// Client fetches the payloads. Defaults to the PostHog client, if it implements RemoteConfigClient.
+	Client RemoteConfigClient
+}
+
+// WithRemoteConfig evaluates flags whose key starts with the configured prefix as remote config flags. Remote config
+// flags are not targeted at users: ObjectEvaluation returns their decoded payload with the STATIC reason and does not
+// require a targeting key. Overrides, caching and fallbacks apply as for other flags. Decrypting encrypted payloads is
+// up to the client. Init fails if neither the configured nor the PostHog client implements RemoteConfigClient.
+func WithRemoteConfig(config RemoteConfig) Option {
+	return func(p *Provider) {
+		if config.Client == nil {
+			config.Client, _ = p.client.(RemoteConfigClient)
+		}
+		p.remoteConfig = &config
+	}
+}
+
+// isRemoteConfig reports whether the flag is a remote config flag.
+func (p *Provider) isRemoteConfig(flag string) bool {
+	return p.remoteConfig != nil && p.remoteConfig.KeyPrefix != "" && strings.HasPrefix(flag, p.remoteConfig.KeyPrefix)
+}
+
+// getRemoteConfig returns the payload of the remote config flag. Overrides, caching and fallbacks apply the same way as
+// for other flags, fetched payloads are reported with the STATIC reason.
+func (p *Provider) getRemoteConfig(ctx context.Context, flag string) (flagResult, error) {
+	if res, ok := p.override(ctx, flag); ok {
+		return res, nil
+	}
+
+	// Remote config is not targeted, so it is cached and kept in the fallback store without a distinct ID.
+	return p.fetchWithFallbacks(ctx, posthog.FeatureFlagPayload{Key: flag}, openfeature.StaticReason, p.fetchRemoteConfig)
+}
+
+// fetchRemoteConfig fetches the payload of the remote config flag and keeps it in the fallback store, if configured.
+func (p *Provider) fetchRemoteConfig(ctx context.Context, payload posthog.FeatureFlagPayload) (interface{}, error) {
+	if p.remoteConfig.Client == nil {
+		return nil, errRemoteConfigUnsupported
+	}
+
+	res, err := p.callClient(ctx, func() (interface{}, error) {
+		return p.remoteConfig.Client.GetRemoteConfigPayload(payload.Key)
+	})
+	if err == nil && p.fallback != nil {
+		p.fallback.Store(payload.Key, payload.DistinctId, res)
+	}
+	return res, err
+}
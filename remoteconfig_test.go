@@ -0,0 +1,158 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_RemoteConfig(t *testing.T) {
+	client := posthogtest.NewClient(
+		posthogtest.Flag{Key: "config-service", Payload: `{"timeout": 5}`},
+		posthogtest.Flag{Key: "config-encoded", Payload: `"{\"timeout\": 10}"`},
+		posthogtest.Flag{Key: "config-invalid", Payload: "not json"},
+		posthogtest.Flag{Key: "config-allowlist", Payload: `["alice", "bob"]`},
+		posthogtest.Flag{Key: "config-text", Payload: `"plain text"`},
+		posthogtest.Flag{Key: "object-flag", Value: `{"timeout": 1}`},
+	)
+	p := NewProvider(client, WithRemoteConfig(RemoteConfig{KeyPrefix: "config-"}))
+
+	tcs := map[string]struct {
+		flag     string
+		evalCtx  openfeature.FlattenedContext
+		expected interface{}
+		reason   openfeature.Reason
+	}{
+		"remote config without targeting key": {
+			flag:     "config-service",
+			expected: map[string]interface{}{"timeout": float64(5)},
+			reason:   openfeature.StaticReason,
+		},
+		"JSON encoded payload is decoded once": {
+			flag:     "config-encoded",
+			expected: `{"timeout": 10}`,
+			reason:   openfeature.StaticReason,
+		},
+		"array payload": {
+			flag:     "config-allowlist",
+			expected: []interface{}{"alice", "bob"},
+			reason:   openfeature.StaticReason,
+		},
+		"JSON string payload": {
+			flag:     "config-text",
+			expected: "plain text",
+			reason:   openfeature.StaticReason,
+		},
+		"invalid payload": {
+			flag:     "config-invalid",
+			expected: "default",
+			reason:   openfeature.ErrorReason,
+		},
+		"unknown remote config": {
+			flag:     "config-unknown",
+			expected: "default",
+			reason:   openfeature.ErrorReason,
+		},
+		"regular flag": {
+			flag:     "object-flag",
+			evalCtx:  openfeature.FlattenedContext{DistinctIDContextKey: "12345"},
+			expected: map[string]interface{}{"timeout": float64(1)},
+			reason:   openfeature.TargetingMatchReason,
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			res := p.ObjectEvaluation(context.Background(), tc.flag, "default", tc.evalCtx)
+			assert.Equal(t, tc.expected, res.Value)
+			assert.Equal(t, tc.reason, res.Reason)
+		})
+	}
+}
+
+func TestProvider_RemoteConfigUnsupported(t *testing.T) {
+	// The fault-injecting client only implements posthog.Client.
+	client := posthogtest.NewFaultyClient(posthogtest.NewClient(posthogtest.Flag{Key: "config-service", Payload: "{}"}), posthogtest.Faults{})
+	p := NewProvider(client, WithRemoteConfig(RemoteConfig{KeyPrefix: "config-"}))
+	assert.ErrorIs(t, p.Init(openfeature.EvaluationContext{}), errRemoteConfigUnsupported)
+
+	res := p.ObjectEvaluation(context.Background(), "config-service", "default", nil)
+	assert.Equal(t, "default", res.Value)
+	assert.Equal(t, openfeature.NewGeneralResolutionError(errRemoteConfigUnsupported.Error()), res.ResolutionError)
+
+	// An explicitly configured client is used instead.
+	p = NewProvider(client, WithRemoteConfig(RemoteConfig{
+		KeyPrefix: "config-",
+		Client:    posthogtest.NewClient(posthogtest.Flag{Key: "config-service", Payload: `{"source": "explicit"}`}),
+	}))
+	require.NoError(t, p.Init(openfeature.EvaluationContext{}))
+	res = p.ObjectEvaluation(context.Background(), "config-service", "default", nil)
+	assert.Equal(t, map[string]interface{}{"source": "explicit"}, res.Value)
+}
+
+// failingRemoteConfigClient fails to fetch remote config payloads.
+type failingRemoteConfigClient struct{}
+
+func (failingRemoteConfigClient) GetRemoteConfigPayload(string) (string, error) {
+	return "", posthogtest.ErrInjected
+}
+
+func TestProvider_RemoteConfigFallbacks(t *testing.T) {
+	client := posthogtest.NewClient(posthogtest.Flag{Key: "config-service", Payload: `{"timeout": 5}`})
+	store := NewMemoryFallbackStore(FallbackStoreConfig{})
+	evaluate := func(ctx context.Context, p *Provider) openfeature.InterfaceResolutionDetail {
+		return p.ObjectEvaluation(ctx, "config-service", "default", nil)
+	}
+
+	// Payloads are cached.
+	p := NewProvider(client, WithRemoteConfig(RemoteConfig{KeyPrefix: "config-"}), WithFallbackStore(store),
+		WithCache(CacheConfig{SoftTTL: time.Minute}))
+	res := evaluate(context.Background(), p)
+	assert.Equal(t, map[string]interface{}{"timeout": float64(5)}, res.Value)
+	assert.Equal(t, openfeature.StaticReason, res.Reason)
+	client.SetFlag(posthogtest.Flag{Key: "config-service", Payload: `{"timeout": 10}`})
+	res = evaluate(context.Background(), p)
+	assert.Equal(t, map[string]interface{}{"timeout": float64(5)}, res.Value)
+	assert.Equal(t, openfeature.CachedReason, res.Reason)
+
+	// Overrides take precedence.
+	res = evaluate(ContextWithOverrides(context.Background(), map[string]interface{}{
+		"config-service": map[string]interface{}{"timeout": 1},
+	}), p)
+	assert.Equal(t, map[string]interface{}{"timeout": float64(1)}, res.Value)
+	assert.Equal(t, OverrideReason, res.Reason)
+
+	// The last known payload is served while PostHog is unreachable.
+	remoteConfig := RemoteConfig{KeyPrefix: "config-", Client: failingRemoteConfigClient{}}
+	p = NewProvider(client, WithRemoteConfig(remoteConfig), WithFallbackStore(store))
+	res = evaluate(context.Background(), p)
+	assert.Equal(t, map[string]interface{}{"timeout": float64(5)}, res.Value)
+	assert.Equal(t, StaleReason, res.Reason)
+
+	// Without a last known payload, the bootstrap value is served.
+	p = NewProvider(client, WithRemoteConfig(remoteConfig), WithBootstrap(Bootstrap{Flags: map[string]interface{}{
+		"config-service": map[string]interface{}{"timeout": 20},
+	}}))
+	res = evaluate(context.Background(), p)
+	assert.Equal(t, map[string]interface{}{"timeout": float64(20)}, res.Value)
+	assert.Equal(t, openfeature.StaticReason, res.Reason)
+}
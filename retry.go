@@ -0,0 +1,132 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"regexp"
+	"syscall"
+	"time"
+)
+
+// Defaults of the RetryConfig.
+const (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = 50 * time.Millisecond
+	DefaultMaxBackoff     = time.Second
+	DefaultMultiplier     = 2
+)
+
+// The PostHog client does not wrap errors of the underlying HTTP client, hence they are matched by their message.
+var retryableErrorPattern = regexp.MustCompile(`(?i)timeout|deadline exceeded|connection reset|status code[^0-9]*5\d\d`)
+
+// RetryConfig configures the retries of failed calls to PostHog.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of calls, including the first one. Defaults to DefaultMaxAttempts.
+	MaxAttempts int
+	// InitialBackoff is the backoff before the first retry. Defaults to DefaultInitialBackoff.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the backoff between retries. Defaults to DefaultMaxBackoff.
+	MaxBackoff time.Duration
+	// Multiplier by which the backoff grows after each retry. Defaults to DefaultMultiplier.
+	Multiplier float64
+	// IsRetryable decides whether a failed call is retried. Defaults to IsRetryableError.
+	IsRetryable func(error) bool
+}
+
+// WithRetry retries failed calls to PostHog with an exponential backoff and full jitter, i.e. the wait before each
+// retry is chosen randomly between zero and the current backoff. Retries stop once the evaluation context is done or
+// its deadline would pass before the next call.
+//
+// When combined with WithCircuitBreaker, every retry counts as a separate call for the circuit breaker.
+func WithRetry(config RetryConfig) Option {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultMaxAttempts
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = DefaultInitialBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultMaxBackoff
+	}
+	if config.Multiplier < 1 {
+		config.Multiplier = DefaultMultiplier
+	}
+	if config.IsRetryable == nil {
+		config.IsRetryable = IsRetryableError
+	}
+
+	return func(p *Provider) {
+		p.retrier = &retrier{
+			config: config,
+			jitter: rand.Int63n,
+		}
+	}
+}
+
+// IsRetryableError reports whether the error returned by the PostHog client is transient, i.e. a timeout, a 5xx
+// response or a reset connection.
+func IsRetryableError(err error) bool {
+	if err == nil || errors.Is(err, errCircuitOpen) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return retryableErrorPattern.MatchString(err.Error())
+}
+
+type retrier struct {
+	config RetryConfig
+	jitter func(n int64) int64
+}
+
+func (r *retrier) do(ctx context.Context, fn func() (interface{}, error)) (interface{}, error) {
+	backoff := r.config.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		res, err := fn()
+		if err == nil || attempt >= r.config.MaxAttempts || !r.config.IsRetryable(err) {
+			return res, err
+		}
+
+		wait := time.Duration(r.jitter(int64(backoff) + 1))
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+			return res, err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return res, err
+		case <-timer.C:
+		}
+
+		backoff = time.Duration(float64(backoff) * r.config.Multiplier)
+		if backoff > r.config.MaxBackoff {
+			backoff = r.config.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/posthog/posthog-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvider_Retry(t *testing.T) {
+	evalCtx := openfeature.FlattenedContext{DistinctIDContextKey: "12345"}
+	transient := errors.New("unexpected status code from /decide/: 503")
+
+	tcs := map[string]struct {
+		failures int
+		err      error
+		ctx      func() (context.Context, context.CancelFunc)
+		calls    int
+		res      string
+	}{
+		"recovers from transient errors": {
+			failures: 2,
+			err:      transient,
+			calls:    3,
+			res:      "posthog",
+		},
+		"gives up after max attempts": {
+			failures: 5,
+			err:      transient,
+			calls:    3,
+			res:      "default",
+		},
+		"does not retry permanent errors": {
+			failures: 1,
+			err:      errors.New("unexpected status code from /decide/: 401"),
+			calls:    1,
+			res:      "default",
+		},
+		"bound by the context deadline": {
+			failures: 5,
+			err:      transient,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 15*time.Millisecond)
+			},
+			calls: 1,
+			res:   "default",
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			client := &flakyClient{
+				Client:   posthogtest.NewClient(posthogtest.Flag{Key: "string-flag", Value: "posthog"}),
+				failures: tc.failures,
+				err:      tc.err,
+			}
+			p := NewProvider(client, WithRetry(RetryConfig{InitialBackoff: 20 * time.Millisecond}))
+			// Always wait for the full backoff to make the test deterministic.
+			p.retrier.jitter = func(n int64) int64 { return n - 1 }
+
+			ctx := context.Background()
+			if tc.ctx != nil {
+				var cancel context.CancelFunc
+				ctx, cancel = tc.ctx()
+				defer cancel()
+			}
+
+			res := p.StringEvaluation(ctx, "string-flag", "default", evalCtx)
+			assert.Equal(t, tc.res, res.Value)
+			assert.Equal(t, tc.calls, client.calls)
+		})
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tcs := map[string]struct {
+		err       error
+		retryable bool
+	}{
+		"nil":               {err: nil},
+		"5xx":               {err: errors.New("unexpected status code from /decide/: 502"), retryable: true},
+		"4xx":               {err: errors.New("unexpected status code from /decide/: 400")},
+		"timeout message":   {err: errors.New("sending request: Post \"https://eu.posthog.com/decide/?v=3\": context deadline exceeded (Client.Timeout exceeded while awaiting headers)"), retryable: true},
+		"deadline exceeded": {err: context.DeadlineExceeded, retryable: true},
+		"canceled":          {err: context.Canceled},
+		"connection reset":  {err: fmt.Errorf("sending request: %w", syscall.ECONNRESET), retryable: true},
+		"net timeout":       {err: &net.DNSError{IsTimeout: true}, retryable: true},
+		"circuit open":      {err: errCircuitOpen},
+		"invalid payload":   {err: posthog.ConfigError{Reason: "DistinctId required"}},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.retryable, IsRetryableError(tc.err))
+		})
+	}
+}
+
+// flakyClient fails the first calls with the given error.
+type flakyClient struct {
+	posthog.Client
+
+	mu       sync.Mutex
+	failures int
+	err      error
+	calls    int
+}
+
+func (c *flakyClient) GetFeatureFlag(payload posthog.FeatureFlagPayload) (interface{}, error) {
+	c.mu.Lock()
+	c.calls++
+	fail := c.calls <= c.failures
+	c.mu.Unlock()
+
+	if fail {
+		return nil, c.err
+	}
+	return c.Client.GetFeatureFlag(payload)
+}
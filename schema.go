@@ -0,0 +1,471 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Schema is the subset of JSON Schema supported for validating object flag values. Parse schemas with ParseSchema,
+// which rejects unsupported keywords, or derive them from Go types with SchemaFor.
+type Schema struct {
+	// Type is one of "object", "array", "string", "number", "integer", "boolean" and "null", or a list thereof.
+	Type                 SchemaTypes        `json:"type,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+}
+
+// annotationKeywords are the keywords of JSON Schema which do not affect validation. They are ignored by ParseSchema.
+var annotationKeywords = map[string]bool{
+	"$id": true, "$schema": true, "$anchor": true, "$comment": true, "$vocabulary": true, "title": true,
+	"description": true, "default": true, "examples": true, "format": true, "deprecated": true, "readOnly": true,
+	"writeOnly": true, "contentEncoding": true, "contentMediaType": true,
+}
+
+// SchemaTypes are the allowed types of a value. It is decoded from a single type or a list of types.
+type SchemaTypes []string
+
+func (t *SchemaTypes) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*t = SchemaTypes{single}
+		return nil
+	}
+	var types []string
+	if err := json.Unmarshal(b, &types); err != nil {
+		return fmt.Errorf("type must be a string or a list of strings: %w", err)
+	}
+	*t = types
+	return nil
+}
+
+// WithSchema validates the values of the object flag against the schema. Values violating the schema resolve to the
+// default value with a TYPE_MISMATCH error naming the path of the violation.
+func WithSchema(flag string, schema *Schema) Option {
+	return func(p *Provider) {
+		if p.schemas == nil {
+			p.schemas = make(map[string]*Schema)
+		}
+		p.schemas[flag] = schema
+	}
+}
+
+// ParseSchema parses a JSON Schema. Annotations, such as "title", "default" or "format", are ignored and references to
+// "definitions" or "$defs" of the schema are resolved. Validation keywords which are not supported are rejected instead
+// of being silently ignored.
+func ParseSchema(b []byte) (*Schema, error) {
+	var raw interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("parsing schema: %w", err)
+	}
+	root, _ := raw.(map[string]interface{})
+	normalized, err := normalizeSchema(root, raw, "$", nil)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = json.Marshal(normalized); err != nil {
+		return nil, fmt.Errorf("parsing schema: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+
+	var schema Schema
+	if err := decoder.Decode(&schema); err != nil {
+		return nil, fmt.Errorf("parsing schema: %w", err)
+	}
+	if err := schema.compile("$"); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// normalizeSchema returns the decoded schema with its annotations and definitions removed and its references replaced
+// by the referenced definitions of the root schema, so only validation keywords remain. Schemas which are not objects
+// are returned as is and rejected when decoding them.
+func normalizeSchema(root map[string]interface{}, schema interface{}, path string, refs []string) (interface{}, error) {
+	obj, ok := schema.(map[string]interface{})
+	if !ok {
+		return schema, nil
+	}
+
+	normalized := make(map[string]interface{}, len(obj))
+	for keyword, value := range obj {
+		if annotationKeywords[keyword] || keyword == "definitions" || keyword == "$defs" {
+			continue
+		}
+		normalized[keyword] = value
+	}
+
+	if ref, ok := normalized["$ref"]; ok {
+		if len(normalized) > 1 {
+			return nil, fmt.Errorf("%s: $ref alongside other validation keywords is not supported", path)
+		}
+		definition, name, err := lookupDefinition(root, ref)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, r := range refs {
+			if r == name {
+				return nil, fmt.Errorf("%s: recursive $ref %q is not supported", path, name)
+			}
+		}
+		return normalizeSchema(root, definition, path, append(refs, name))
+	}
+
+	if properties, ok := normalized["properties"].(map[string]interface{}); ok {
+		normalizedProperties := make(map[string]interface{}, len(properties))
+		for name, property := range properties {
+			normalizedProperty, err := normalizeSchema(root, property, path+"."+name, refs)
+			if err != nil {
+				return nil, err
+			}
+			normalizedProperties[name] = normalizedProperty
+		}
+		normalized["properties"] = normalizedProperties
+	}
+	if items, ok := normalized["items"]; ok {
+		normalizedItems, err := normalizeSchema(root, items, path+"[]", refs)
+		if err != nil {
+			return nil, err
+		}
+		normalized["items"] = normalizedItems
+	}
+	return normalized, nil
+}
+
+// lookupDefinition returns the definition referenced by ref, which must point to "definitions" or "$defs" of the root
+// schema, and its name.
+func lookupDefinition(root map[string]interface{}, ref interface{}) (interface{}, string, error) {
+	name, _ := ref.(string)
+	for _, prefix := range []string{"#/definitions/", "#/$defs/"} {
+		key, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		definitions, _ := root[strings.TrimSuffix(prefix[2:], "/")].(map[string]interface{})
+		if definition, ok := definitions[key]; ok {
+			return definition, name, nil
+		}
+		return nil, "", fmt.Errorf("$ref %q not found", name)
+	}
+	return nil, "", fmt.Errorf("$ref %v is not supported, only references to definitions of the schema are", ref)
+}
+
+// compile checks the types and compiles the patterns of the schema.
+func (s *Schema) compile(path string) error {
+	for _, t := range s.Type {
+		switch t {
+		case "object", "array", "string", "number", "integer", "boolean", "null":
+		default:
+			return fmt.Errorf("%s: unknown type %q", path, t)
+		}
+	}
+	if s.Pattern != "" {
+		if _, err := compilePattern(s.Pattern); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for name, property := range s.Properties {
+		if err := property.compile(path + "." + name); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile(path + "[]")
+	}
+	return nil
+}
+
+// SchemaFor derives a schema from the Go type of v, following the rules of encoding/json. Struct fields are required
+// unless they are pointers or tagged with omitempty. Values of maps and interfaces are not validated.
+func SchemaFor(v interface{}) (*Schema, error) {
+	return schemaForType(reflect.TypeOf(v))
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+func schemaForType(t reflect.Type) (*Schema, error) {
+	if t == nil {
+		return &Schema{}, nil
+	}
+	if t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType) {
+		// The encoding is up to the type.
+		return &Schema{}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema, err := schemaForType(t.Elem())
+		if err != nil || len(schema.Type) == 0 {
+			return schema, err
+		}
+		schema.Type = append(schema.Type, "null")
+		return schema, nil
+	case reflect.Bool:
+		return &Schema{Type: SchemaTypes{"boolean"}}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: SchemaTypes{"integer"}}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: SchemaTypes{"number"}}, nil
+	case reflect.String:
+		return &Schema{Type: SchemaTypes{"string"}}, nil
+	case reflect.Interface:
+		return &Schema{}, nil
+	case reflect.Map:
+		return &Schema{Type: SchemaTypes{"object", "null"}}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Byte slices are encoded as base64 strings.
+			return &Schema{Type: SchemaTypes{"string", "null"}}, nil
+		}
+		items, err := schemaForType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		schema := &Schema{Type: SchemaTypes{"array"}, Items: items}
+		if t.Kind() == reflect.Slice {
+			schema.Type = append(schema.Type, "null")
+		}
+		return schema, nil
+	case reflect.Struct:
+		schema := &Schema{Type: SchemaTypes{"object"}, Properties: make(map[string]*Schema)}
+		if err := addStructFields(schema, t); err != nil {
+			return nil, err
+		}
+		return schema, nil
+	default:
+		return nil, fmt.Errorf("type %s cannot be used as schema", t)
+	}
+}
+
+// addStructFields adds the fields of the struct as properties to the schema. Fields of embedded structs are promoted.
+func addStructFields(schema *Schema, t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if err := addStructFields(schema, embedded); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		property, err := schemaForType(field.Type)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		schema.Properties[name] = property
+		if field.Type.Kind() != reflect.Pointer && !strings.Contains(","+opts+",", ",omitempty,") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return nil
+}
+
+// Validate validates the decoded JSON value against the schema. The error names the path of the first violation.
+func (s *Schema) Validate(v interface{}) error {
+	return s.validate("$", v)
+}
+
+func (s *Schema) validate(path string, v interface{}) error {
+	if len(s.Type) > 0 && !s.hasType(v) {
+		return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(s.Type, " or "), jsonType(v))
+	}
+	if len(s.Enum) > 0 && !containsJSON(s.Enum, v) {
+		return fmt.Errorf("%s: %v is not one of %v", path, v, s.Enum)
+	}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return s.validateObject(path, t)
+	case []interface{}:
+		if s.MinItems != nil && len(t) < *s.MinItems {
+			return fmt.Errorf("%s: expected at least %d items, got %d", path, *s.MinItems, len(t))
+		}
+		if s.MaxItems != nil && len(t) > *s.MaxItems {
+			return fmt.Errorf("%s: expected at most %d items, got %d", path, *s.MaxItems, len(t))
+		}
+		if s.Items != nil {
+			for i, item := range t {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(t)
+		if s.MinLength != nil && length < *s.MinLength {
+			return fmt.Errorf("%s: expected at least %d characters, got %d", path, *s.MinLength, length)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fmt.Errorf("%s: expected at most %d characters, got %d", path, *s.MaxLength, length)
+		}
+		if s.Pattern != "" {
+			r, err := compilePattern(s.Pattern)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if !r.MatchString(t) {
+				return fmt.Errorf("%s: %q does not match %q", path, t, s.Pattern)
+			}
+		}
+	default:
+		n, err := toFloat(v)
+		if err != nil {
+			return nil
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			return fmt.Errorf("%s: %v is less than %v", path, n, *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			return fmt.Errorf("%s: %v is greater than %v", path, n, *s.Maximum)
+		}
+	}
+	return nil
+}
+
+// compiledPatterns caches the compiled patterns of schemas by pattern.
+var compiledPatterns sync.Map
+
+type compiledPattern struct {
+	regexp *regexp.Regexp
+	err    error
+}
+
+// compilePattern returns the compiled pattern. Each pattern is compiled once, also for schemas constructed in Go.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if compiled, ok := compiledPatterns.Load(pattern); ok {
+		return compiled.(compiledPattern).regexp, compiled.(compiledPattern).err
+	}
+	r, err := regexp.Compile(pattern)
+	compiled, _ := compiledPatterns.LoadOrStore(pattern, compiledPattern{regexp: r, err: err})
+	return compiled.(compiledPattern).regexp, compiled.(compiledPattern).err
+}
+
+func (s *Schema) validateObject(path string, obj map[string]interface{}) error {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			return fmt.Errorf("%s: missing required property %q", path, name)
+		}
+	}
+	for _, name := range sortedKeys(obj) {
+		property, ok := s.Properties[name]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				return fmt.Errorf("%s: unexpected property %q", path, name)
+			}
+			continue
+		}
+		if err := property.validate(path+"."+name, obj[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) hasType(v interface{}) bool {
+	actual := jsonType(v)
+	for _, t := range s.Type {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType returns the JSON Schema type of the decoded value. Integral numbers are reported as integer.
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	if n, err := toFloat(v); err == nil {
+		if n == float64(int64(n)) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func containsJSON(values []interface{}, v interface{}) bool {
+	for _, value := range values {
+		if reflect.DeepEqual(value, v) {
+			return true
+		}
+		a, aErr := toFloat(value)
+		b, bErr := toFloat(v)
+		if aErr == nil && bErr == nil && a == b {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSchema validates the value of the object flag against its schema, if any.
+func (p *Provider) validateSchema(flag string, v interface{}) error {
+	schema, ok := p.schemas[flag]
+	if !ok {
+		return nil
+	}
+	if err := schema.Validate(v); err != nil {
+		return fmt.Errorf("value of %q violates schema: %w", flag, err)
+	}
+	return nil
+}
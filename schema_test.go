@@ -0,0 +1,252 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const checkoutSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["timeout"],
+	"additionalProperties": false,
+	"properties": {
+		"timeout": {"type": "integer", "minimum": 1, "maximum": 60},
+		"mode": {"enum": ["fast", "safe"]},
+		"currency": {"type": ["string", "null"], "pattern": "^[A-Z]{3}$"},
+		"steps": {"type": "array", "maxItems": 2, "items": {"type": "string", "minLength": 1}}
+	}
+}`
+
+func TestParseSchema(t *testing.T) {
+	tcs := map[string]struct {
+		schema string
+		err    bool
+	}{
+		"supported keywords":    {schema: checkoutSchema},
+		"unsupported keyword":   {schema: `{"oneOf": [{"type": "string"}]}`, err: true},
+		"unknown type":          {schema: `{"properties": {"a": {"type": "text"}}}`, err: true},
+		"invalid pattern":       {schema: `{"pattern": "("}`, err: true},
+		"additional properties": {schema: `{"additionalProperties": {"type": "string"}}`, err: true},
+		"annotations": {schema: `{
+			"$id": "https://example.com/checkout.json",
+			"$comment": "checkout",
+			"title": "Checkout",
+			"properties": {"since": {"type": "string", "format": "date-time", "default": "", "examples": ["2024-01-01"]}}
+		}`},
+		"nested unsupported keyword": {schema: `{"properties": {"a": {"description": "a", "anyOf": []}}}`, err: true},
+		"references":                 {schema: `{"$defs": {"id": {"type": "string"}}, "items": {"$ref": "#/$defs/id"}}`},
+		"missing reference":          {schema: `{"items": {"$ref": "#/definitions/id"}}`, err: true},
+		"remote reference":           {schema: `{"$ref": "https://example.com/checkout.json"}`, err: true},
+		"recursive reference":        {schema: `{"definitions": {"node": {"items": {"$ref": "#/definitions/node"}}}, "$ref": "#/definitions/node"}`, err: true},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseSchema([]byte(tc.schema))
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestSchema_Validate(t *testing.T) {
+	schema, err := ParseSchema([]byte(checkoutSchema))
+	require.NoError(t, err)
+
+	tcs := map[string]struct {
+		value string
+		err   string
+	}{
+		"valid":               {value: `{"timeout": 5, "mode": "fast", "currency": "EUR", "steps": ["cart"]}`},
+		"null":                {value: `{"timeout": 5, "currency": null}`},
+		"not an object":       {value: `[]`, err: "$: expected object, got array"},
+		"missing required":    {value: `{}`, err: `$: missing required property "timeout"`},
+		"wrong type":          {value: `{"timeout": "5s"}`, err: "$.timeout: expected integer, got string"},
+		"not an integer":      {value: `{"timeout": 1.5}`, err: "$.timeout: expected integer, got number"},
+		"below minimum":       {value: `{"timeout": 0}`, err: "$.timeout: 0 is less than 1"},
+		"above maximum":       {value: `{"timeout": 61}`, err: "$.timeout: 61 is greater than 60"},
+		"not in enum":         {value: `{"timeout": 5, "mode": "slow"}`, err: "$.mode: slow is not one of [fast safe]"},
+		"pattern mismatch":    {value: `{"timeout": 5, "currency": "eur"}`, err: `$.currency: "eur" does not match "^[A-Z]{3}$"`},
+		"too many items":      {value: `{"timeout": 5, "steps": ["a", "b", "c"]}`, err: "$.steps: expected at most 2 items, got 3"},
+		"invalid item":        {value: `{"timeout": 5, "steps": ["a", ""]}`, err: "$.steps[1]: expected at least 1 characters, got 0"},
+		"additional property": {value: `{"timeout": 5, "timeotu": 5}`, err: `$: unexpected property "timeotu"`},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			var value interface{}
+			require.NoError(t, json.Unmarshal([]byte(tc.value), &value))
+
+			err := schema.Validate(value)
+			if tc.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestParseSchema_References(t *testing.T) {
+	schema, err := ParseSchema([]byte(`{
+		"definitions": {"currency": {"type": "string", "pattern": "^[A-Z]{3}$"}},
+		"type": "object",
+		"properties": {
+			"currency": {"$ref": "#/definitions/currency"},
+			"accepted": {"type": "array", "items": {"$ref": "#/definitions/currency"}}
+		}
+	}`))
+	require.NoError(t, err)
+
+	assert.NoError(t, schema.Validate(map[string]interface{}{"currency": "EUR", "accepted": []interface{}{"USD"}}))
+	assert.EqualError(t, schema.Validate(map[string]interface{}{"accepted": []interface{}{"usd"}}),
+		`$.accepted[0]: "usd" does not match "^[A-Z]{3}$"`)
+}
+
+func TestSchema_ValidatePatternCompiledOnce(t *testing.T) {
+	schema := &Schema{Type: SchemaTypes{"string"}, Pattern: "^[A-Z]{3}$"}
+	require.NoError(t, schema.Validate("EUR"))
+	pattern, err := compilePattern(schema.Pattern)
+	require.NoError(t, err)
+
+	// Copies of the schema share the compiled pattern.
+	copied := *schema
+	assert.Error(t, copied.Validate("eur"))
+	compiled, err := compilePattern(copied.Pattern)
+	require.NoError(t, err)
+	assert.Same(t, pattern, compiled)
+
+	// Changing the pattern of a copy does not reuse the stale pattern.
+	copied.Pattern = "^[a-z]{3}$"
+	assert.NoError(t, copied.Validate("eur"))
+
+	schema = &Schema{Pattern: "("}
+	assert.Error(t, schema.Validate("a"))
+}
+
+type checkoutConfig struct {
+	Timeout  int           `json:"timeout"`
+	Mode     string        `json:"mode,omitempty"`
+	Currency *string       `json:"currency"`
+	Steps    []string      `json:"steps"`
+	Delay    time.Duration `json:"delay,omitempty"`
+	Since    time.Time     `json:"since,omitempty"`
+	Ignored  string        `json:"-"`
+	Extra    map[string]interface{}
+	embeddedConfig
+}
+
+type embeddedConfig struct {
+	Region string `json:"region,omitempty"`
+}
+
+func TestSchemaFor(t *testing.T) {
+	schema, err := SchemaFor(checkoutConfig{})
+	require.NoError(t, err)
+
+	assert.Equal(t, SchemaTypes{"object"}, schema.Type)
+	assert.ElementsMatch(t, []string{"timeout", "steps", "Extra"}, schema.Required)
+	assert.ElementsMatch(t, []string{"timeout", "mode", "currency", "steps", "delay", "since", "Extra", "region"}, sortedKeys(schema.Properties))
+	assert.Equal(t, SchemaTypes{"string", "null"}, schema.Properties["currency"].Type)
+	assert.Equal(t, SchemaTypes{"string"}, schema.Properties["steps"].Items.Type)
+	assert.Empty(t, schema.Properties["since"].Type)
+
+	var value interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"timeout": 5, "steps": null, "Extra": {}, "region": "eu", "since": "2024-01-01T00:00:00Z"}`), &value))
+	assert.NoError(t, schema.Validate(value))
+	require.NoError(t, json.Unmarshal([]byte(`{"timeout": 5, "steps": [1], "Extra": {}}`), &value))
+	assert.EqualError(t, schema.Validate(value), "$.steps[0]: expected string, got integer")
+
+	_, err = SchemaFor(struct{ C chan int }{})
+	assert.Error(t, err)
+}
+
+func TestProvider_Schema(t *testing.T) {
+	schema, err := ParseSchema([]byte(checkoutSchema))
+	require.NoError(t, err)
+	structSchema, err := SchemaFor(checkoutConfig{})
+	require.NoError(t, err)
+
+	client := posthogtest.NewClient(
+		posthogtest.Flag{Key: "checkout", Value: `{"timeout": 5}`},
+		posthogtest.Flag{Key: "checkout-broken", Value: `{"timeout": "5s"}`},
+		posthogtest.Flag{Key: "checkout-struct", Value: `{"timeout": 5, "steps": ["cart"], "Extra": {}}`},
+		posthogtest.Flag{Key: "config-checkout", Payload: `{"timeout": 0}`},
+		posthogtest.Flag{Key: "unvalidated", Value: `{"timeout": "5s"}`},
+	)
+	p := NewProvider(client,
+		WithRemoteConfig(RemoteConfig{KeyPrefix: "config-"}),
+		WithSchema("checkout", schema),
+		WithSchema("checkout-broken", schema),
+		WithSchema("checkout-struct", structSchema),
+		WithSchema("config-checkout", schema),
+	)
+	evalCtx := openfeature.FlattenedContext{DistinctIDContextKey: "12345"}
+
+	tcs := map[string]struct {
+		flag     string
+		expected interface{}
+		err      string
+	}{
+		"valid": {
+			flag:     "checkout",
+			expected: map[string]interface{}{"timeout": float64(5)},
+		},
+		"invalid": {
+			flag:     "checkout-broken",
+			expected: "default",
+			err:      `TYPE_MISMATCH: value of "checkout-broken" violates schema: $.timeout: expected integer, got string`,
+		},
+		"struct schema": {
+			flag:     "checkout-struct",
+			expected: map[string]interface{}{"timeout": float64(5), "steps": []interface{}{"cart"}, "Extra": map[string]interface{}{}},
+		},
+		"invalid remote config": {
+			flag:     "config-checkout",
+			expected: "default",
+			err:      `TYPE_MISMATCH: value of "config-checkout" violates schema: $.timeout: 0 is less than 1`,
+		},
+		"without schema": {
+			flag:     "unvalidated",
+			expected: map[string]interface{}{"timeout": "5s"},
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			res := p.ObjectEvaluation(context.Background(), tc.flag, "default", evalCtx)
+			assert.Equal(t, tc.expected, res.Value)
+			if tc.err == "" {
+				assert.NoError(t, res.Error())
+				return
+			}
+			assert.Equal(t, openfeature.ErrorReason, res.Reason)
+			assert.EqualError(t, res.Error(), tc.err)
+		})
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/posthog/posthog-go"
+)
+
+// snapshotRetryInterval is the interval in which loading the live definitions is retried after a failure.
+const snapshotRetryInterval = 5 * time.Second
+
+// noPersonalAPIKeyMessage is the message of the error the PostHog client returns for the flag definitions unless it
+// is configured with a personal API key.
+const noPersonalAPIKeyMessage = "specifying a PersonalApiKey is required for using feature flags"
+
+// isNoPersonalAPIKey reports whether the error is the permanent error of loading the flag definitions with a client
+// configured without a personal API key. The client logs it on every attempt.
+func isNoPersonalAPIKey(err error) bool {
+	return err != nil && strings.Contains(err.Error(), noPersonalAPIKeyMessage)
+}
+
+// WithDefinitionsSnapshot persists the flag definitions at path once PostHog loaded them, and bootstraps from the
+// persisted definitions on Init. Until the live definitions are loaded, flags are evaluated locally from the snapshot
+// and reported with the CACHED reason. Flags which cannot be evaluated locally, e.g. because they rely on cohorts,
+// group aggregation or experience continuity, are evaluated by PostHog. If loading the live definitions fails, the
+// snapshot keeps being served while the loading is retried until it succeeds or the provider is shut down.
+//
+// The definitions are loaded by PostHog only for clients configured with a personal API key. For other clients, the
+// snapshot is no longer served and loading is not retried once the client reported the missing key, see Err.
+func WithDefinitionsSnapshot(path string) Option {
+	return func(p *Provider) {
+		p.snapshot = &definitionsSnapshot{
+			path:   path,
+			after:  time.After,
+			loaded: make(chan struct{}),
+		}
+	}
+}
+
+type definitionsSnapshot struct {
+	path  string
+	after func(time.Duration) <-chan time.Time
+	// loaded is closed once the live definitions have been loaded and persisted.
+	loaded     chan struct{}
+	loadedOnce sync.Once
+
+	mu    sync.RWMutex
+	flags map[string]posthog.FeatureFlag
+	live  bool
+	err   error
+	// unsupported is set if the client does not load the live definitions, as it has no personal API key.
+	unsupported bool
+	// stop is closed to stop refreshing. It is nil unless refreshing.
+	stop chan struct{}
+}
+
+// start bootstraps from the persisted definitions and starts refreshing them, unless the live definitions have been
+// loaded already, the client does not load them or the refresh is running.
+func (s *definitionsSnapshot) start(client posthog.Client) {
+	s.mu.Lock()
+	if s.live || s.unsupported || s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	s.stop = stop
+	s.mu.Unlock()
+
+	s.load()
+	go s.refresh(client, stop)
+}
+
+// shutdown stops refreshing.
+func (s *definitionsSnapshot) shutdown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// load reads the persisted definitions. A missing or unreadable snapshot is not fatal, the flags are evaluated by
+// PostHog instead.
+func (s *definitionsSnapshot) load() {
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+
+	var flags []posthog.FeatureFlag
+	if err == nil {
+		err = json.Unmarshal(b, &flags)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.err = fmt.Errorf("loading definitions snapshot %q: %w", s.path, err)
+		return
+	}
+	s.flags = make(map[string]posthog.FeatureFlag, len(flags))
+	for _, flag := range flags {
+		s.flags[flag.Key] = flag
+	}
+}
+
+// refresh waits for the client to load the live definitions and persists them. Failed loads are retried until stop
+// is closed, the snapshot is served meanwhile. Clients without a personal API key never load the live definitions, so
+// the snapshot is dropped instead of being served forever.
+func (s *definitionsSnapshot) refresh(client posthog.Client, stop chan struct{}) {
+	for {
+		// GetFeatureFlags blocks until the definitions have been loaded for the first time.
+		flags, err := client.GetFeatureFlags()
+		if err == nil {
+			s.persist(flags)
+			return
+		}
+
+		s.mu.Lock()
+		s.err = fmt.Errorf("loading live definitions: %w", err)
+		if isNoPersonalAPIKey(err) {
+			s.unsupported = true
+			s.flags = nil
+			s.stop = nil
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-stop:
+			return
+		case <-s.after(snapshotRetryInterval):
+		}
+	}
+}
+
+// persist persists the live definitions and stops serving the snapshot.
+func (s *definitionsSnapshot) persist(flags []posthog.FeatureFlag) {
+	defer s.loadedOnce.Do(func() { close(s.loaded) })
+
+	b, err := json.Marshal(flags)
+	if err == nil {
+		err = writeFileAtomic(s.path, b)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.live = true
+	s.flags = nil
+	s.stop = nil
+	s.err = nil
+	if err != nil {
+		s.err = fmt.Errorf("persisting definitions snapshot %q: %w", s.path, err)
+	}
+}
+
+// evaluate evaluates the flag from the snapshot. It reports false if the live definitions have been loaded, the flag
+// is not part of the snapshot or cannot be evaluated locally.
+func (s *definitionsSnapshot) evaluate(payload posthog.FeatureFlagPayload) (interface{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.live {
+		return nil, false
+	}
+	flag, ok := s.flags[payload.Key]
+	if !ok {
+		return nil, false
+	}
+
+	res, err := evaluateLocally(flag, payload.DistinctId, payload.PersonProperties)
+	if err != nil {
+		return nil, false
+	}
+	return res, true
+}
+
+// evaluateAll evaluates all flags from the snapshot. It reports false if the live definitions have been loaded or any
+// flag cannot be evaluated locally.
+func (s *definitionsSnapshot) evaluateAll(payload posthog.FeatureFlagPayload) (map[string]interface{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.live || s.flags == nil {
+		return nil, false
+	}
+	values := make(map[string]interface{}, len(s.flags))
+	for key, flag := range s.flags {
+		res, err := evaluateLocally(flag, payload.DistinctId, payload.PersonProperties)
+		if err != nil {
+			return nil, false
+		}
+		values[key] = res
+	}
+	return values, true
+}
+
+// payload returns the payload of the flag for the evaluated value from the snapshot.
+func (s *definitionsSnapshot) payload(key string, value interface{}) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.live {
+		return "", false
+	}
+	flag, ok := s.flags[key]
+	if !ok {
+		return "", false
+	}
+	return flag.Filters.Payloads[fmt.Sprint(value)], true
+}
+
+// Err returns the error of loading or persisting the snapshot or of the last failed attempt to load the live
+// definitions, if any. Errors of failed attempts are cleared once the live definitions have been loaded.
+func (s *definitionsSnapshot) Err() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.err
+}
@@ -0,0 +1,229 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dhaus67/openfeature-posthog-go/posthogtest"
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/posthog/posthog-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errNoPersonalAPIKey is the error of the PostHog client for the flag definitions without a personal API key.
+var errNoPersonalAPIKey = errors.New("specifying a PersonalApiKey is required for using feature flags")
+
+// loadingClient blocks GetFeatureFlags until the definitions are released, like the PostHog client does until the
+// definitions have been loaded for the first time. The first failures loads fail, all loads fail with err if set.
+type loadingClient struct {
+	*flakyClient
+	definitions []posthog.FeatureFlag
+	release     chan struct{}
+	failures    atomic.Int32
+	err         error
+	loads       atomic.Int32
+}
+
+func (c *loadingClient) GetFeatureFlags() ([]posthog.FeatureFlag, error) {
+	<-c.release
+	c.loads.Add(1)
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.failures.Add(-1) >= 0 {
+		return nil, errors.New("flags were not successfully fetched yet")
+	}
+	return c.definitions, nil
+}
+
+func TestProvider_DefinitionsSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "definitions.json")
+	b, err := json.Marshal([]posthog.FeatureFlag{{
+		Key:    "string-flag",
+		Active: true,
+		Filters: posthog.Filter{
+			Groups: []posthog.FeatureFlagCondition{{RolloutPercentage: ptr[uint8](100)}},
+			Multivariate: &posthog.Variants{Variants: []posthog.FlagVariant{
+				{Key: "snapshot", RolloutPercentage: ptr[uint8](100)},
+			}},
+		},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+
+	client := &loadingClient{
+		flakyClient: &flakyClient{Client: posthogtest.NewClient(
+			posthogtest.Flag{Key: "string-flag", Value: "posthog"},
+			posthogtest.Flag{Key: "int-flag", Value: "20"},
+		)},
+		definitions: localDefinitions,
+		release:     make(chan struct{}),
+	}
+	p := NewProvider(client, WithDefinitionsSnapshot(path))
+	require.NoError(t, p.Init(openfeature.EvaluationContext{}))
+	evalCtx := openfeature.FlattenedContext{DistinctIDContextKey: "12345"}
+
+	// While the live definitions are loading, flags are evaluated from the snapshot.
+	s := p.StringEvaluation(context.Background(), "string-flag", "default", evalCtx)
+	assert.Equal(t, "snapshot", s.Value)
+	assert.Equal(t, openfeature.CachedReason, s.Reason)
+	assert.Equal(t, 0, client.calls)
+
+	// Flags missing from the snapshot are evaluated by PostHog.
+	i := p.IntEvaluation(context.Background(), "int-flag", 10, evalCtx)
+	assert.Equal(t, int64(20), i.Value)
+	assert.Equal(t, openfeature.TargetingMatchReason, i.Reason)
+	assert.Equal(t, 1, client.calls)
+
+	// Once loaded, the live definitions are persisted and flags are evaluated by PostHog.
+	close(client.release)
+	<-p.snapshot.loaded
+	require.NoError(t, p.snapshot.Err())
+
+	s = p.StringEvaluation(context.Background(), "string-flag", "default", evalCtx)
+	assert.Equal(t, "posthog", s.Value)
+	assert.Equal(t, openfeature.TargetingMatchReason, s.Reason)
+
+	expected, err := json.Marshal(localDefinitions)
+	require.NoError(t, err)
+	b, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(expected), string(b))
+}
+
+func TestProvider_DefinitionsSnapshotFailedLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "definitions.json")
+	b, err := json.Marshal(localDefinitions)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+
+	client := &loadingClient{
+		flakyClient: &flakyClient{Client: posthogtest.NewClient(posthogtest.Flag{Key: "variant-flag", Value: "posthog"})},
+		definitions: localDefinitions,
+		release:     make(chan struct{}),
+	}
+	client.failures.Store(1)
+	p := NewProvider(client, WithDefinitionsSnapshot(path))
+	retry := make(chan time.Time)
+	p.snapshot.after = func(time.Duration) <-chan time.Time { return retry }
+
+	require.NoError(t, p.Init(openfeature.EvaluationContext{}))
+	// Initializing again, e.g. when the provider is registered once more, neither loads twice nor panics.
+	require.NoError(t, p.Init(openfeature.EvaluationContext{}))
+	close(client.release)
+	evalCtx := openfeature.FlattenedContext{DistinctIDContextKey: "12345", PropertiesContextKey: PostHogProperties{PersonProperties: posthog.Properties{"plan": "enterprise"}}}
+
+	// The snapshot keeps being served after the live definitions failed to load.
+	require.Eventually(t, func() bool { return p.snapshot.Err() != nil }, time.Second, time.Millisecond)
+	s := p.StringEvaluation(context.Background(), "variant-flag", "default", evalCtx)
+	assert.Equal(t, "test", s.Value)
+	assert.Equal(t, openfeature.CachedReason, s.Reason)
+	assert.Equal(t, 0, client.calls)
+
+	// Loading is retried until it succeeds.
+	retry <- time.Now()
+	<-p.snapshot.loaded
+	require.NoError(t, p.snapshot.Err())
+	s = p.StringEvaluation(context.Background(), "variant-flag", "default", evalCtx)
+	assert.Equal(t, "posthog", s.Value)
+	assert.Equal(t, openfeature.TargetingMatchReason, s.Reason)
+
+	// Once loaded, Init and Shutdown are no-ops.
+	require.NoError(t, p.Init(openfeature.EvaluationContext{}))
+	p.Shutdown()
+}
+
+func TestProvider_DefinitionsSnapshotShutdown(t *testing.T) {
+	client := &loadingClient{
+		flakyClient: &flakyClient{Client: posthogtest.NewClient()},
+		release:     make(chan struct{}),
+	}
+	client.failures.Store(1)
+	close(client.release)
+	p := NewProvider(client, WithDefinitionsSnapshot(filepath.Join(t.TempDir(), "definitions.json")))
+	retry := make(chan time.Time)
+	p.snapshot.after = func(time.Duration) <-chan time.Time { return retry }
+
+	require.NoError(t, p.Init(openfeature.EvaluationContext{}))
+	require.Eventually(t, func() bool { return p.snapshot.Err() != nil }, time.Second, time.Millisecond)
+	p.Shutdown()
+
+	// The retry is not attempted after the shutdown.
+	select {
+	case retry <- time.Now():
+		t.Fatal("loading was retried after shutdown")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestProvider_DefinitionsSnapshotWithoutPersonalAPIKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "definitions.json")
+	b, err := json.Marshal(localDefinitions)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+
+	client := &loadingClient{
+		flakyClient: &flakyClient{Client: posthogtest.NewClient(posthogtest.Flag{Key: "variant-flag", Value: "posthog"})},
+		release:     make(chan struct{}),
+		err:         errNoPersonalAPIKey,
+	}
+	close(client.release)
+	p := NewProvider(client, WithDefinitionsSnapshot(path))
+	p.snapshot.after = func(time.Duration) <-chan time.Time {
+		t.Error("loading was retried without a personal API key")
+		return nil
+	}
+
+	require.NoError(t, p.Init(openfeature.EvaluationContext{}))
+	require.Eventually(t, func() bool { return p.snapshot.Err() != nil }, time.Second, time.Millisecond)
+	assert.ErrorIs(t, p.snapshot.Err(), errNoPersonalAPIKey)
+
+	// The snapshot is no longer served, as it would never be refreshed.
+	s := p.StringEvaluation(context.Background(), "variant-flag", "default", openfeature.FlattenedContext{DistinctIDContextKey: "12345"})
+	assert.Equal(t, "posthog", s.Value)
+	assert.Equal(t, openfeature.TargetingMatchReason, s.Reason)
+
+	// Initializing again does not retry either.
+	require.NoError(t, p.Init(openfeature.EvaluationContext{}))
+	assert.Equal(t, int32(1), client.loads.Load())
+}
+
+func TestProvider_DefinitionsSnapshotMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "definitions.json")
+	client := &loadingClient{
+		flakyClient: &flakyClient{Client: posthogtest.NewClient(posthogtest.Flag{Key: "string-flag", Value: "posthog"})},
+		definitions: localDefinitions,
+		release:     make(chan struct{}),
+	}
+	p := NewProvider(client, WithDefinitionsSnapshot(path))
+	require.NoError(t, p.Init(openfeature.EvaluationContext{}))
+	defer close(client.release)
+
+	s := p.StringEvaluation(context.Background(), "string-flag", "default", openfeature.FlattenedContext{
+		DistinctIDContextKey: "12345",
+	})
+	assert.Equal(t, "posthog", s.Value)
+	assert.Equal(t, openfeature.TargetingMatchReason, s.Reason)
+	assert.NoError(t, p.snapshot.Err())
+}
@@ -0,0 +1,128 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/open-feature/go-sdk/openfeature"
+)
+
+var _ openfeature.FeatureProvider = (*StaticProvider)(nil)
+
+// StaticProvider returns fixed values per flag, independent of the evaluation context. It is meant as safety net in a
+// ChainProvider, e.g. backed by a file checked in alongside the code.
+//
+// Values may either be of the evaluated type or a string, which is parsed the same way as flag values returned by
+// PostHog. Flags without a value are reported as not found.
+type StaticProvider struct {
+	name   string
+	values map[string]interface{}
+}
+
+// NewStaticProvider creates a new provider returning the given values.
+func NewStaticProvider(values map[string]interface{}) *StaticProvider {
+	copied := make(map[string]interface{}, len(values))
+	for flag, value := range values {
+		copied[flag] = value
+	}
+
+	return &StaticProvider{
+		name:   "Static",
+		values: copied,
+	}
+}
+
+// NewFileProvider creates a new provider returning the values of the JSON file at path. The file must contain a single
+// object mapping flag keys to their values, e.g. {"new-checkout": true, "max-retries": 3}.
+func NewFileProvider(path string) (*StaticProvider, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal(b, &values); err != nil {
+		return nil, fmt.Errorf("parsing flag file %q: %w", path, err)
+	}
+
+	p := NewStaticProvider(values)
+	p.name = "File"
+	return p, nil
+}
+
+// Metadata returns the providers metadata.
+func (p *StaticProvider) Metadata() openfeature.Metadata {
+	return openfeature.Metadata{
+		Name: p.name,
+	}
+}
+
+// Hooks returns the list of hooks of the provider. The static provider does not have any hooks, an empty slice is returned.
+func (p *StaticProvider) Hooks() []openfeature.Hook {
+	return []openfeature.Hook{}
+}
+
+func (p *StaticProvider) BooleanEvaluation(_ context.Context, flag string, defaultValue bool, _ openfeature.FlattenedContext) openfeature.BoolResolutionDetail {
+	value, detail := resolveStatic(p.values, flag, defaultValue)
+	return openfeature.BoolResolutionDetail{Value: value, ProviderResolutionDetail: detail}
+}
+
+func (p *StaticProvider) FloatEvaluation(_ context.Context, flag string, defaultValue float64, _ openfeature.FlattenedContext) openfeature.FloatResolutionDetail {
+	value, detail := resolveStatic(p.values, flag, defaultValue)
+	return openfeature.FloatResolutionDetail{Value: value, ProviderResolutionDetail: detail}
+}
+
+func (p *StaticProvider) IntEvaluation(_ context.Context, flag string, defaultValue int64, _ openfeature.FlattenedContext) openfeature.IntResolutionDetail {
+	value, detail := resolveStatic(p.values, flag, defaultValue)
+	return openfeature.IntResolutionDetail{Value: value, ProviderResolutionDetail: detail}
+}
+
+func (p *StaticProvider) ObjectEvaluation(_ context.Context, flag string, defaultValue interface{}, _ openfeature.FlattenedContext) openfeature.InterfaceResolutionDetail {
+	value, ok := p.values[flag]
+	if !ok {
+		return openfeature.InterfaceResolutionDetail{Value: defaultValue, ProviderResolutionDetail: staticNotFound(flag)}
+	}
+
+	return openfeature.InterfaceResolutionDetail{
+		Value: value,
+		ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
+			Reason: openfeature.StaticReason,
+		},
+	}
+}
+
+func (p *StaticProvider) StringEvaluation(_ context.Context, flag string, defaultValue string, _ openfeature.FlattenedContext) openfeature.StringResolutionDetail {
+	value, detail := resolveStatic(p.values, flag, defaultValue)
+	return openfeature.StringResolutionDetail{Value: value, ProviderResolutionDetail: detail}
+}
+
+func resolveStatic[T any](values map[string]interface{}, flag string, defaultValue T) (T, openfeature.ProviderResolutionDetail) {
+	value, ok := values[flag]
+	if !ok {
+		return defaultValue, staticNotFound(flag)
+	}
+	return resolveOverride(value, defaultValue)
+}
+
+func staticNotFound(flag string) openfeature.ProviderResolutionDetail {
+	return openfeature.ProviderResolutionDetail{
+		ResolutionError: openfeature.NewFlagNotFoundResolutionError(fmt.Sprintf("%q not found", flag)),
+		Reason:          openfeature.DefaultReason,
+	}
+}
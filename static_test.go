@@ -0,0 +1,71 @@
+// Copyright 2024 Daniel Haus <dhaus67>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openfeatureposthog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticProvider(t *testing.T) {
+	p := NewStaticProvider(map[string]interface{}{
+		"bool-flag":   true,
+		"int-flag":    "20",
+		"float-flag":  1.5,
+		"string-flag": "static",
+	})
+
+	b := p.BooleanEvaluation(context.Background(), "bool-flag", false, nil)
+	assert.True(t, b.Value)
+	assert.Equal(t, openfeature.StaticReason, b.Reason)
+
+	i := p.IntEvaluation(context.Background(), "int-flag", 10, nil)
+	assert.Equal(t, int64(20), i.Value)
+
+	f := p.FloatEvaluation(context.Background(), "float-flag", 1, nil)
+	assert.Equal(t, 1.5, f.Value)
+
+	s := p.StringEvaluation(context.Background(), "unknown-flag", "default", nil)
+	assert.Equal(t, "default", s.Value)
+	assert.Equal(t, openfeature.NewFlagNotFoundResolutionError(`"unknown-flag" not found`), s.ResolutionError)
+
+	s = p.StringEvaluation(context.Background(), "int-flag", "default", nil)
+	assert.Equal(t, "20", s.Value)
+}
+
+func TestNewFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"int-flag": 20, "object-flag": {"enabled": true}}`), 0o600))
+
+	p, err := NewFileProvider(path)
+	require.NoError(t, err)
+	assert.Equal(t, "File", p.Metadata().Name)
+
+	i := p.IntEvaluation(context.Background(), "int-flag", 10, nil)
+	assert.Equal(t, int64(20), i.Value)
+
+	o := p.ObjectEvaluation(context.Background(), "object-flag", nil, nil)
+	assert.Equal(t, map[string]interface{}{"enabled": true}, o.Value)
+
+	require.NoError(t, os.WriteFile(path, []byte(`["not", "an", "object"]`), 0o600))
+	_, err = NewFileProvider(path)
+	assert.Error(t, err)
+}